@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/okanay/file-upload-go/db"
+	"github.com/okanay/file-upload-go/internal/asset"
+	"github.com/okanay/file-upload-go/storage"
+	"github.com/okanay/file-upload-go/utils/metadata"
+	"github.com/okanay/file-upload-go/utils/placeholder"
+	"log"
+	"os"
+)
+
+const batchSize = 100
+
+// Backfill computes what newer uploads get at ingest for assets stored
+// before it existed. It is safe to run repeatedly, finished rows are skipped.
+func main() {
+	// Env Configuration
+	err := godotenv.Load(".env.local")
+	if err != nil {
+		log.Fatalf("Error loading .env file")
+	}
+
+	sqlDB, err := db.Init(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatalf("Error connecting to the database: %v", err)
+	}
+	defer db.Close(sqlDB)
+
+	store, err := storage.Init(os.Getenv("STORAGE_DRIVER"))
+	if err != nil {
+		log.Fatalf("Error initializing storage: %v", err)
+	}
+
+	repository := asset.NewRepository(sqlDB)
+
+	if err := backfill(repository, store); err != nil {
+		log.Fatalf("Error backfilling assets: %v", err)
+	}
+}
+
+// backfill computes placeholders and image metadata for every asset that is
+// missing them, from one decode of the original.
+func backfill(repository *asset.Repository, store storage.Storage) error {
+	ctx := context.Background()
+	lastID, updated, failed, skipped := 0, 0, 0, 0
+
+	for {
+		assets, err := repository.GetAssetsToBackfill(lastID, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(assets) == 0 {
+			break
+		}
+
+		for _, a := range assets {
+			lastID = a.ID
+
+			info, err := store.Stat(ctx, a.StorageKey)
+			if err != nil {
+				// Left for the next run, the file may be reachable again
+				fmt.Println("[BACKFILL] Could not read", a.Filename, err)
+				skipped++
+				continue
+			}
+
+			reader := storage.NewReadSeeker(ctx, store, info)
+			meta, img, err := metadata.Extract(reader)
+			reader.Close()
+
+			var placeholders placeholder.Placeholders
+			if err == nil {
+				placeholders, err = placeholder.Generate(img)
+			}
+			if err != nil {
+				fmt.Println("[BACKFILL] Could not decode", a.Filename, err)
+				failed++
+			} else {
+				updated++
+			}
+
+			if err := repository.UpdateAssetPlaceholders(a.ID, placeholders.BlurHash, placeholders.ThumbHash); err != nil {
+				return err
+			}
+			if err := repository.UpdateAssetMetadata(a.ID, meta); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Printf("[BACKFILL] %d assets updated, %d could not be decoded, %d skipped.\n", updated, failed, skipped)
+	return nil
+}
@@ -2,13 +2,15 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/secure"
 	"github.com/gin-gonic/gin"
-	"log"
+	"github.com/okanay/file-upload-go/types"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 )
 
@@ -31,8 +33,8 @@ func CorsConfig() gin.HandlerFunc {
 
 	return cors.New(cors.Config{
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset"},
+		ExposeHeaders:    []string{"Content-Length", "Location", "Tus-Resumable", "Tus-Version", "Tus-Max-Size", "Tus-Extension", "Upload-Length", "Upload-Metadata", "Upload-Offset", "Upload-Expires", "Asset-Filename"},
 		AllowOrigins:     origins,
 		AllowWildcard:    true,
 		AllowCredentials: true,
@@ -40,37 +42,109 @@ func CorsConfig() gin.HandlerFunc {
 	})
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+const USER_CONTEXT_KEY = "user"
+const SCOPES_CONTEXT_KEY = "scopes"
+const API_KEY_CONTEXT_KEY = "api_key"
+
+type SessionValidator interface {
+	ValidateSession(token string) (types.User, error)
+}
+
+type APIKeyValidator interface {
+	ValidateAPIKey(key string) (types.User, types.APIKey, error)
+}
+
+// AuthMiddleware accepts a session cookie or an API key sent as
+// "Authorization: Bearer <key>". Requests made with a key carry its scopes.
+func AuthMiddleware(sessions SessionValidator, keys APIKeyValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		secretKey := os.Getenv("SECRET_SESSION_KEY")
-		fmt.Println("[SECRET-KEY]", secretKey)
+		var user types.User
+		var key *types.APIKey
+		var err error
 
-		if secretKey == "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			var used types.APIKey
+			user, used, err = keys.ValidateAPIKey(strings.TrimSpace(bearer))
+			if used.Scopes == nil {
+				used.Scopes = []string{}
+			}
+			key = &used
+		} else {
+			token, cookieErr := c.Cookie("session_token")
+			if cookieErr != nil || token == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				c.Abort()
+				return
+			}
+			user, err = sessions.ValidateSession(token)
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
-
-		token, err := c.Cookie("session_token")
 		if err != nil {
 			fmt.Println("[ERROR]", err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
 			c.Abort()
 			return
 		}
 
-		fmt.Println("[TOKEN]", token)
-		if token != secretKey {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
+		c.Set(USER_CONTEXT_KEY, user)
+		if key != nil {
+			c.Set(SCOPES_CONTEXT_KEY, key.Scopes)
+			c.Set(API_KEY_CONTEXT_KEY, key)
+		}
+		c.Next()
+	}
+}
+
+// RequireScope lets API keys through only when they have the scope. Session
+// users are not limited by scopes.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes := CurrentScopes(c)
+		if scopes == nil {
+			c.Next()
 			return
 		}
 
-		log.Println("Authentication successful")
-		c.Next()
+		for _, s := range scopes {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the '" + scope + "' scope"})
+		c.Abort()
 	}
 }
 
+// CurrentScopes returns the scopes of the API key used for the request, or
+// nil when the request is authenticated with a session.
+func CurrentScopes(c *gin.Context) []string {
+	scopes, _ := c.Get(SCOPES_CONTEXT_KEY)
+	current, _ := scopes.([]string)
+	return current
+}
+
+// CurrentAPIKey returns the API key used for the request, or nil when the
+// request is authenticated with a session.
+func CurrentAPIKey(c *gin.Context) *types.APIKey {
+	key, _ := c.Get(API_KEY_CONTEXT_KEY)
+	current, _ := key.(*types.APIKey)
+	return current
+}
+
+// CurrentUser returns the user authenticated by AuthMiddleware.
+func CurrentUser(c *gin.Context) types.User {
+	user, _ := c.Get(USER_CONTEXT_KEY)
+	current, _ := user.(types.User)
+	return current
+}
+
 func CookieMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
@@ -81,6 +155,7 @@ func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
 		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
 
 		done := make(chan bool, 1)
 		go func() {
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_tus_uploads_updated_at ON tus_uploads;
+DROP TABLE IF EXISTS tus_uploads;
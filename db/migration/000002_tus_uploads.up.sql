@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS tus_uploads
+(
+    id TEXT PRIMARY KEY,
+    creator TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    description TEXT,
+    metadata TEXT NOT NULL DEFAULT '',
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    asset_filename TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_expires_at ON tus_uploads (expires_at);
+
+CREATE TRIGGER update_tus_uploads_updated_at
+    BEFORE UPDATE ON tus_uploads
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
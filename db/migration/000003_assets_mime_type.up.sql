@@ -0,0 +1,11 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS mime_type TEXT NOT NULL DEFAULT '';
+
+UPDATE assets
+SET mime_type = CASE LOWER(type)
+    WHEN '.jpg' THEN 'image/jpeg'
+    WHEN '.jpeg' THEN 'image/jpeg'
+    WHEN '.png' THEN 'image/png'
+    WHEN '.webp' THEN 'image/webp'
+    ELSE 'application/octet-stream'
+END
+WHERE mime_type = '';
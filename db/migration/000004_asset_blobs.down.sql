@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_assets_hash;
+ALTER TABLE assets DROP COLUMN IF EXISTS hash;
+DROP TRIGGER IF EXISTS update_blobs_updated_at ON blobs;
+DROP TABLE IF EXISTS blobs;
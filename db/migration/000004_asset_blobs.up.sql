@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS blobs
+(
+    hash TEXT PRIMARY KEY,
+    storage_key TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    mime_type TEXT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS hash TEXT REFERENCES blobs (hash);
+
+CREATE INDEX IF NOT EXISTS idx_assets_hash ON assets (hash);
+
+CREATE TRIGGER update_blobs_updated_at
+    BEFORE UPDATE ON blobs
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
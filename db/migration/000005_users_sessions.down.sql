@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS sessions;
+DROP TRIGGER IF EXISTS update_users_updated_at ON users;
+DROP TABLE IF EXISTS users;
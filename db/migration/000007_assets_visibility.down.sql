@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_assets_visibility;
+ALTER TABLE assets DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,4 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'private'));
+
+CREATE INDEX IF NOT EXISTS idx_assets_visibility ON assets (visibility);
@@ -0,0 +1,2 @@
+ALTER TABLE assets DROP COLUMN IF EXISTS thumb_hash;
+ALTER TABLE assets DROP COLUMN IF EXISTS blur_hash;
@@ -0,0 +1,2 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS blur_hash TEXT;
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS thumb_hash TEXT;
@@ -0,0 +1,23 @@
+DROP INDEX IF EXISTS idx_assets_metadata;
+DROP INDEX IF EXISTS idx_assets_camera_model;
+DROP INDEX IF EXISTS idx_assets_taken_at;
+DROP INDEX IF EXISTS idx_assets_height;
+DROP INDEX IF EXISTS idx_assets_width;
+
+ALTER TABLE assets
+    DROP COLUMN IF EXISTS metadata,
+    DROP COLUMN IF EXISTS dominant_colors,
+    DROP COLUMN IF EXISTS color_space,
+    DROP COLUMN IF EXISTS gps_longitude,
+    DROP COLUMN IF EXISTS gps_latitude,
+    DROP COLUMN IF EXISTS focal_length,
+    DROP COLUMN IF EXISTS iso,
+    DROP COLUMN IF EXISTS f_number,
+    DROP COLUMN IF EXISTS exposure_time,
+    DROP COLUMN IF EXISTS taken_at,
+    DROP COLUMN IF EXISTS lens_model,
+    DROP COLUMN IF EXISTS camera_model,
+    DROP COLUMN IF EXISTS camera_make,
+    DROP COLUMN IF EXISTS orientation,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width;
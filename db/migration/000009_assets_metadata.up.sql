@@ -0,0 +1,23 @@
+ALTER TABLE assets
+    ADD COLUMN IF NOT EXISTS width INTEGER,
+    ADD COLUMN IF NOT EXISTS height INTEGER,
+    ADD COLUMN IF NOT EXISTS orientation SMALLINT,
+    ADD COLUMN IF NOT EXISTS camera_make TEXT,
+    ADD COLUMN IF NOT EXISTS camera_model TEXT,
+    ADD COLUMN IF NOT EXISTS lens_model TEXT,
+    ADD COLUMN IF NOT EXISTS taken_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS exposure_time TEXT,
+    ADD COLUMN IF NOT EXISTS f_number REAL,
+    ADD COLUMN IF NOT EXISTS iso INTEGER,
+    ADD COLUMN IF NOT EXISTS focal_length REAL,
+    ADD COLUMN IF NOT EXISTS gps_latitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS gps_longitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS color_space TEXT,
+    ADD COLUMN IF NOT EXISTS dominant_colors TEXT[],
+    ADD COLUMN IF NOT EXISTS metadata JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_assets_width ON assets (width);
+CREATE INDEX IF NOT EXISTS idx_assets_height ON assets (height);
+CREATE INDEX IF NOT EXISTS idx_assets_taken_at ON assets (taken_at);
+CREATE INDEX IF NOT EXISTS idx_assets_camera_model ON assets (camera_model);
+CREATE INDEX IF NOT EXISTS idx_assets_metadata ON assets USING GIN (metadata);
@@ -0,0 +1,3 @@
+ALTER TABLE assets
+    DROP COLUMN IF EXISTS archive_key,
+    DROP COLUMN IF EXISTS processing;
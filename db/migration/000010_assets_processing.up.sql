@@ -0,0 +1,3 @@
+ALTER TABLE assets
+    ADD COLUMN IF NOT EXISTS processing JSONB NOT NULL DEFAULT '{"mode": "keep"}',
+    ADD COLUMN IF NOT EXISTS archive_key TEXT;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS tags
+(
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS asset_tags
+(
+    asset_id BIGINT NOT NULL REFERENCES assets (id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (asset_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_asset_tags_tag_id ON asset_tags (tag_id);
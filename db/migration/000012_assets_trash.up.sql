@@ -0,0 +1,3 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_assets_deleted_at ON assets (deleted_at);
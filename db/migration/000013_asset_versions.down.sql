@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS asset_versions;
+
+ALTER TABLE assets DROP COLUMN IF EXISTS version;
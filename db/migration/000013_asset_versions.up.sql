@@ -0,0 +1,21 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS asset_versions
+(
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    asset_id BIGINT NOT NULL REFERENCES assets (id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    hash TEXT NOT NULL REFERENCES blobs (hash),
+    mime_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    blur_hash TEXT,
+    thumb_hash TEXT,
+    image_metadata JSONB,
+    processing JSONB NOT NULL DEFAULT '{"mode": "keep"}',
+    archive_key TEXT,
+    replaced_by TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (asset_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_asset_versions_hash ON asset_versions (hash);
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS increment_assets_revision ON assets;
+DROP FUNCTION IF EXISTS increment_revision_column();
+
+ALTER TABLE assets DROP COLUMN IF EXISTS revision;
+ALTER TABLE assets DROP COLUMN IF EXISTS alt_text;
+ALTER TABLE assets DROP COLUMN IF EXISTS title;
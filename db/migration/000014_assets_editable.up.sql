@@ -0,0 +1,19 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS title TEXT;
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS alt_text TEXT;
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION increment_revision_column()
+    RETURNS TRIGGER AS $$
+BEGIN
+    NEW.revision = OLD.revision + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Only edits of the descriptive fields are revisions. Trashing, replacing
+-- content and backfills leave the revision alone, so they don't make a
+-- client's If-Match stale.
+CREATE TRIGGER increment_assets_revision
+    BEFORE UPDATE OF name, creator, description, title, alt_text ON assets
+    FOR EACH ROW
+EXECUTE FUNCTION increment_revision_column();
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS collections
+(
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    creator TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_collections_updated_at
+    BEFORE UPDATE ON collections
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS collection_assets
+(
+    collection_id BIGINT NOT NULL REFERENCES collections (id) ON DELETE CASCADE,
+    asset_id BIGINT NOT NULL REFERENCES assets (id) ON DELETE CASCADE,
+    added_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, asset_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_collection_assets_asset_id ON collection_assets (asset_id);
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS update_asset_tags_search ON asset_tags;
+DROP TRIGGER IF EXISTS update_assets_search ON assets;
+DROP FUNCTION IF EXISTS update_asset_tags_search_column();
+DROP FUNCTION IF EXISTS update_asset_search_column();
+DROP FUNCTION IF EXISTS refresh_asset_search(BIGINT);
+
+DROP TABLE IF EXISTS asset_search;
+
+ALTER TABLE assets DROP COLUMN IF EXISTS original_filename;
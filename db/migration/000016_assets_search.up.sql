@@ -0,0 +1,58 @@
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS original_filename TEXT;
+
+-- The search document of an asset lives in its own table, so tagging an
+-- asset does not count as an update of the asset row. The 'simple'
+-- configuration does no stemming, names and tags are rarely English words.
+CREATE TABLE IF NOT EXISTS asset_search
+(
+    asset_id BIGINT PRIMARY KEY REFERENCES assets (id) ON DELETE CASCADE,
+    document TSVECTOR NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_asset_search_document ON asset_search USING GIN (document);
+
+CREATE OR REPLACE FUNCTION refresh_asset_search(target BIGINT)
+    RETURNS VOID AS $$
+BEGIN
+    INSERT INTO asset_search (asset_id, document)
+    SELECT id,
+           setweight(to_tsvector('simple', COALESCE(name, '') || ' ' || COALESCE(title, '')), 'A') ||
+           setweight(to_tsvector('simple', COALESCE((SELECT string_agg(tags.name, ' ') FROM asset_tags JOIN tags ON tags.id = asset_tags.tag_id WHERE asset_tags.asset_id = assets.id), '')), 'B') ||
+           setweight(to_tsvector('simple', regexp_replace(COALESCE(original_filename, ''), '[._-]+', ' ', 'g')), 'B') ||
+           setweight(to_tsvector('simple', COALESCE(description, '') || ' ' || COALESCE(alt_text, '')), 'C')
+    FROM assets WHERE id = target
+    ON CONFLICT (asset_id) DO UPDATE SET document = EXCLUDED.document;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION update_asset_search_column()
+    RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM refresh_asset_search(NEW.id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION update_asset_tags_search_column()
+    RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM refresh_asset_search(OLD.asset_id);
+    ELSE
+        PERFORM refresh_asset_search(NEW.asset_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER update_assets_search
+    AFTER INSERT OR UPDATE OF name, title, description, alt_text, original_filename ON assets
+    FOR EACH ROW
+EXECUTE FUNCTION update_asset_search_column();
+
+CREATE TRIGGER update_asset_tags_search
+    AFTER INSERT OR DELETE ON asset_tags
+    FOR EACH ROW
+EXECUTE FUNCTION update_asset_tags_search_column();
+
+SELECT refresh_asset_search(id) FROM assets;
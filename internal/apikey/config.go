@@ -0,0 +1,19 @@
+package apikey
+
+import "time"
+
+const KEY_PREFIX = "fu_"
+
+// LAST_USED_INTERVAL is how stale last_used_at may get before a request
+// with the key writes it again.
+const LAST_USED_INTERVAL = time.Minute
+
+const (
+	SCOPE_UPLOAD = "upload"
+	SCOPE_DELETE = "delete"
+	SCOPE_LIST   = "list"
+	// SCOPE_ADMIN manages sessions and API keys
+	SCOPE_ADMIN = "admin"
+)
+
+var SCOPES = []string{SCOPE_UPLOAD, SCOPE_DELETE, SCOPE_LIST, SCOPE_ADMIN}
@@ -0,0 +1,71 @@
+package apikey
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/db"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"net/http"
+	"strconv"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{
+		service: s,
+	}
+}
+
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var req types.CreateAPIKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and scopes are required."})
+		return
+	}
+
+	plainKey, key, err := h.service.CreateAPIKey(db.CurrentUser(c), db.CurrentAPIKey(c), req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":     plainKey,
+		"api_key": key,
+		"message": "Store this key now, it will not be shown again.",
+	})
+}
+
+func (h *Handler) GetAPIKeys(c *gin.Context) {
+	keys, err := h.service.GetAPIKeys(db.CurrentUser(c).ID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key id."})
+		return
+	}
+
+	err = h.service.RevokeAPIKey(db.CurrentUser(c).ID, keyID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key has been revoked."})
+}
+
+func (h *Handler) handleError(c *gin.Context, err error) {
+	response := httperrors.Handle(err)
+	c.JSON(response.Status, gin.H{"error": response.Message})
+}
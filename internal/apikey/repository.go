@@ -0,0 +1,100 @@
+package apikey
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/okanay/file-upload-go/types"
+	"time"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+type IRepository interface {
+	CreateAPIKey(userID int, name, prefix, keyHash string, scopes []string, expiresAt *time.Time) (types.APIKey, error)
+	GetUserAPIKeys(userID int) ([]types.APIKey, error)
+	UseAPIKey(keyHash string) (types.User, []string, error)
+	RevokeAPIKey(userID, keyID int) (bool, error)
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateAPIKey(userID int, name, prefix, keyHash string, scopes []string, expiresAt *time.Time) (types.APIKey, error) {
+	var key types.APIKey
+
+	query := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+	err := r.db.QueryRow(query, userID, name, prefix, keyHash, pq.Array(scopes), expiresAt).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt)
+	if err != nil {
+		return key, err
+	}
+
+	return key, nil
+}
+
+func (r *Repository) GetUserAPIKeys(userID int) ([]types.APIKey, error) {
+	keys := []types.APIKey{}
+
+	query := `SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key types.APIKey
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt); err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// UseAPIKey records the usage of an active key and returns its owner and
+// the key. Revoked and expired keys are not found. The usage is written at
+// most once per LAST_USED_INTERVAL so busy keys don't update their row on
+// every request.
+func (r *Repository) UseAPIKey(keyHash string) (types.User, types.APIKey, error) {
+	var user types.User
+	var key types.APIKey
+
+	query := `WITH active AS (
+			SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+			FROM api_keys
+			WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		), used AS (
+			UPDATE api_keys SET last_used_at = NOW()
+			WHERE id IN (SELECT id FROM active) AND (last_used_at IS NULL OR last_used_at < NOW() - make_interval(secs => $2))
+			RETURNING id, last_used_at
+		)
+		SELECT u.id, u.username, u.created_at, u.updated_at,
+			a.id, a.user_id, a.name, a.prefix, a.scopes, a.expires_at, COALESCE(used.last_used_at, a.last_used_at), a.revoked_at, a.created_at
+		FROM active a JOIN users u ON u.id = a.user_id LEFT JOIN used ON used.id = a.id`
+
+	err := r.db.QueryRow(query, keyHash, LAST_USED_INTERVAL.Seconds()).Scan(&user.ID, &user.Username, &user.CreatedAt, &user.UpdatedAt,
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt)
+	if err != nil {
+		return user, key, err
+	}
+
+	return user, key, nil
+}
+
+func (r *Repository) RevokeAPIKey(userID, keyID int) (bool, error) {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	result, err := r.db.Exec(query, keyID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
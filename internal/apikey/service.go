@@ -0,0 +1,102 @@
+package apikey
+
+import (
+	"fmt"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Service struct {
+	repository *Repository
+}
+
+func NewService(r *Repository) *Service {
+	return &Service{repository: r}
+}
+
+// CreateAPIKey mints a new key for the user. caller is the key making the
+// request, nil for a browser session, and a key can never grant more scopes
+// or outlive the key that created it. The plain key is returned once.
+func (s *Service) CreateAPIKey(user types.User, caller *types.APIKey, req types.CreateAPIKeyReq) (string, types.APIKey, error) {
+	if strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 {
+		return "", types.APIKey{}, httperrors.NewHttpError("Name and at least one scope are required.", http.StatusBadRequest)
+	}
+
+	for _, scope := range req.Scopes {
+		if !hasScope(SCOPES, scope) {
+			return "", types.APIKey{}, httperrors.NewHttpError(fmt.Sprintf("Unknown scope %q. Allowed scopes: %v", scope, SCOPES), http.StatusBadRequest)
+		}
+		if caller != nil && !hasScope(caller.Scopes, scope) {
+			return "", types.APIKey{}, httperrors.NewHttpError(fmt.Sprintf("Cannot grant scope %q.", scope), http.StatusForbidden)
+		}
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return "", types.APIKey{}, httperrors.NewHttpError("expires_at must be in the future.", http.StatusBadRequest)
+	}
+	req.ExpiresAt = clampExpiry(req.ExpiresAt, caller)
+
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", types.APIKey{}, err
+	}
+
+	// (fu_AbCdEfGh...)
+	plainKey := KEY_PREFIX + token
+	prefix := plainKey[:len(KEY_PREFIX)+8]
+
+	key, err := s.repository.CreateAPIKey(user.ID, req.Name, prefix, utils.HashToken(plainKey), req.Scopes, req.ExpiresAt)
+	if err != nil {
+		return "", key, err
+	}
+
+	fmt.Println("[API KEY] Key created:", key.Prefix, "for", user.Username)
+	return plainKey, key, nil
+}
+
+func (s *Service) ValidateAPIKey(plainKey string) (types.User, types.APIKey, error) {
+	return s.repository.UseAPIKey(utils.HashToken(plainKey))
+}
+
+func (s *Service) GetAPIKeys(userID int) ([]types.APIKey, error) {
+	return s.repository.GetUserAPIKeys(userID)
+}
+
+func (s *Service) RevokeAPIKey(userID, keyID int) error {
+	revoked, err := s.repository.RevokeAPIKey(userID, keyID)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return httperrors.NewHttpError("API key not found.", http.StatusNotFound)
+	}
+
+	fmt.Println("[API KEY] Key revoked:", keyID)
+	return nil
+}
+
+// clampExpiry limits the expiry of a key created with the caller key to the
+// caller's own.
+func clampExpiry(expiresAt *time.Time, caller *types.APIKey) *time.Time {
+	if caller == nil || caller.ExpiresAt == nil {
+		return expiresAt
+	}
+	if expiresAt == nil || expiresAt.After(*caller.ExpiresAt) {
+		return caller.ExpiresAt
+	}
+	return expiresAt
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
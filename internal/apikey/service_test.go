@@ -0,0 +1,35 @@
+package apikey
+
+import (
+	"github.com/okanay/file-upload-go/types"
+	"testing"
+	"time"
+)
+
+func TestClampExpiry(t *testing.T) {
+	now := time.Now()
+	soon, later := now.Add(time.Hour), now.Add(24*time.Hour)
+
+	tests := []struct {
+		name      string
+		requested *time.Time
+		caller    *types.APIKey
+		want      *time.Time
+	}{
+		{"session keeps the request", &later, nil, &later},
+		{"session without expiry", nil, nil, nil},
+		{"caller without expiry", &later, &types.APIKey{}, &later},
+		{"earlier than the caller", &soon, &types.APIKey{ExpiresAt: &later}, &soon},
+		{"later than the caller", &later, &types.APIKey{ExpiresAt: &soon}, &soon},
+		{"no expiry under an expiring caller", nil, &types.APIKey{ExpiresAt: &soon}, &soon},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clampExpiry(tt.requested, tt.caller)
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package asset
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/okanay/file-upload-go/storage"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultDerivativeBudget = 1 << 30
+const DefaultEvictInterval = 5 * time.Minute
+
+type derivativeEntry struct {
+	key  string
+	size int64
+}
+
+// DerivativeCache tracks the blur and optimized objects in storage by last
+// access and keeps their total size under a byte budget by deleting the
+// least recently used ones. Nothing here holds a lock while talking to
+// storage, so eviction never blocks delivery. Derivatives that are pinned
+// while a request serves them are never evicted.
+type DerivativeCache struct {
+	storage  storage.Storage
+	budget   int64
+	interval time.Duration
+	mutex    sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	size     int64
+	pins     map[string]int
+	evicting map[string]chan struct{}
+	wake     chan struct{}
+}
+
+func NewDerivativeCache(store storage.Storage, budget int64, interval time.Duration, dirs ...string) *DerivativeCache {
+	cache := &DerivativeCache{
+		storage:  store,
+		budget:   budget,
+		interval: interval,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		pins:     make(map[string]int),
+		evicting: make(map[string]chan struct{}),
+		wake:     make(chan struct{}, 1),
+	}
+
+	cache.load(dirs)
+	fmt.Printf("[DERIVATIVE CACHE] Tracking %d derivatives, %d of %d bytes used.\n", cache.lru.Len(), cache.size, budget)
+
+	go cache.evictRoutine()
+	return cache
+}
+
+// load picks up derivatives left by a previous run, ordered by modification
+// time since their access times are unknown.
+func (d *DerivativeCache) load(dirs []string) {
+	var objects []storage.ObjectInfo
+	for _, dir := range dirs {
+		listed, err := d.storage.List(context.Background(), dir+"/")
+		if err != nil {
+			fmt.Println("[DERIVATIVE CACHE] Error listing", dir, err)
+			continue
+		}
+		objects = append(objects, listed...)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].LastModified.Before(objects[j].LastModified)
+	})
+
+	for _, object := range objects {
+		d.Track(object.Key, object.Size)
+	}
+}
+
+// Touch marks a derivative as just used. It reports whether the key is
+// tracked.
+func (d *DerivativeCache) Touch(key string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	element, ok := d.entries[key]
+	if ok {
+		d.lru.MoveToFront(element)
+	}
+	return ok
+}
+
+// Pin keeps a derivative from being evicted until the returned function is
+// called. A derivative that is being deleted right now is waited for, so
+// the caller finds it missing and generates it again instead of serving a
+// file that disappears.
+func (d *DerivativeCache) Pin(key string) func() {
+	d.mutex.Lock()
+	for {
+		done, ok := d.evicting[key]
+		if !ok {
+			break
+		}
+		d.mutex.Unlock()
+		<-done
+		d.mutex.Lock()
+	}
+	d.pins[key]++
+	d.mutex.Unlock()
+
+	return func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+
+		if d.pins[key]--; d.pins[key] <= 0 {
+			delete(d.pins, key)
+		}
+	}
+}
+
+// Track records a derivative of the given size as the most recently used
+// one and wakes the evictor when the budget is exceeded.
+func (d *DerivativeCache) Track(key string, size int64) {
+	d.mutex.Lock()
+	if element, ok := d.entries[key]; ok {
+		entry := element.Value.(*derivativeEntry)
+		d.size += size - entry.size
+		entry.size = size
+		d.lru.MoveToFront(element)
+	} else {
+		d.entries[key] = d.lru.PushFront(&derivativeEntry{key: key, size: size})
+		d.size += size
+	}
+	over := d.size > d.budget
+	d.mutex.Unlock()
+
+	if over {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Purge deletes the tracked derivatives of one asset, for when the asset
+// itself goes away or changes. It only frees space: derivative names carry
+// the content hash, so ones missed here are never served for new content.
+func (d *DerivativeCache) Purge(blurDir, optimizedDir, filename string) {
+	base := strings.TrimSuffix(filename, path.Ext(filename))
+	blurKey := path.Join(blurDir, filename)
+	blurPrefix := path.Join(blurDir, base) + "-"
+	optimizedPrefix := path.Join(optimizedDir, base) + "-"
+
+	var keys []string
+	d.mutex.Lock()
+	for key, element := range d.entries {
+		if key == blurKey || strings.HasPrefix(key, blurPrefix) || strings.HasPrefix(key, optimizedPrefix) {
+			keys = append(keys, key)
+			d.remove(element)
+		}
+	}
+	d.mutex.Unlock()
+
+	for _, key := range keys {
+		if err := d.storage.Delete(context.Background(), key); err != nil {
+			fmt.Println("[DERIVATIVE CACHE] Error deleting", key, err)
+		}
+	}
+}
+
+func (d *DerivativeCache) evictRoutine() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		}
+		d.evict()
+	}
+}
+
+// evict removes least recently used derivatives one at a time until the
+// total is back under budget. Pinned derivatives are skipped.
+func (d *DerivativeCache) evict() {
+	evicted := 0
+
+	for {
+		d.mutex.Lock()
+		back := d.lru.Back()
+		for back != nil && d.pins[back.Value.(*derivativeEntry).key] > 0 {
+			back = back.Prev()
+		}
+		if d.size <= d.budget || back == nil {
+			d.mutex.Unlock()
+			break
+		}
+		entry := back.Value.(*derivativeEntry)
+		d.remove(back)
+		done := make(chan struct{})
+		d.evicting[entry.key] = done
+		d.mutex.Unlock()
+
+		err := d.storage.Delete(context.Background(), entry.key)
+
+		d.mutex.Lock()
+		delete(d.evicting, entry.key)
+		d.mutex.Unlock()
+		close(done)
+
+		if err != nil {
+			fmt.Println("[DERIVATIVE CACHE] Error deleting", entry.key, err)
+			continue
+		}
+		evicted++
+	}
+
+	if evicted > 0 {
+		fmt.Printf("[DERIVATIVE CACHE] Evicted %d derivatives.\n", evicted)
+	}
+}
+
+func (d *DerivativeCache) remove(element *list.Element) {
+	entry := d.lru.Remove(element).(*derivativeEntry)
+	delete(d.entries, entry.key)
+	d.size -= entry.size
+}
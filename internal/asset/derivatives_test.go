@@ -0,0 +1,45 @@
+package asset
+
+import (
+	"context"
+	"errors"
+	"github.com/okanay/file-upload-go/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDerivativeCacheSkipsPinned(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocalStorage(t.TempDir())
+	cache := NewDerivativeCache(store, 1, time.Hour)
+
+	keys := []string{"optimized/old-60.jpg", "optimized/new-60.jpg"}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "image/jpeg"); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+	}
+
+	// The least recently used one is pinned, so the newer one has to go
+	unpin := cache.Pin(keys[0])
+	cache.Track(keys[0], 1)
+	cache.Track(keys[1], 1)
+	cache.evict()
+
+	if _, err := store.Stat(ctx, keys[0]); err != nil {
+		t.Fatalf("pinned derivative was evicted: %v", err)
+	}
+	if _, err := store.Stat(ctx, keys[1]); !errors.Is(err, storage.ErrNotExist) {
+		t.Fatalf("unpinned derivative: got %v, want ErrNotExist", err)
+	}
+
+	// Once released it is evictable again
+	unpin()
+	cache.Track("optimized/other-60.jpg", 1)
+	cache.evict()
+
+	if _, err := store.Stat(ctx, keys[0]); !errors.Is(err, storage.ErrNotExist) {
+		t.Fatalf("released derivative: got %v, want ErrNotExist", err)
+	}
+}
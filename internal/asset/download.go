@@ -0,0 +1,173 @@
+package asset
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/types"
+	"io"
+	"path"
+	"strconv"
+	"time"
+)
+
+// MaxDownloadAssets caps how many assets a single bulk download may contain.
+var MaxDownloadAssets = 1000
+
+// DownloadTimeout bounds a bulk download. It replaces the shared request
+// timeout, which a large archive on a slow connection easily outlasts.
+var DownloadTimeout = 30 * time.Minute
+
+// downloadEntry is an asset record in the manifest of a bulk download,
+// together with the path of its file inside the archive.
+type downloadEntry struct {
+	types.Assets
+	File string `json:"file"`
+}
+
+type downloadManifest struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Quality   int             `json:"quality,omitempty"`
+	Assets    []downloadEntry `json:"assets"`
+}
+
+// DownloadAssets streams a ZIP archive of the originals of the assets named
+// by repeated 'filename' parameters, or of every asset matching the listing
+// filters when no filename is given. With 'quality' the optimized derivatives
+// are packed instead. A manifest.json with the asset records closes the
+// archive. Nothing is buffered, each file is copied from storage into the
+// response as it is written.
+func (h *AssetHandler) DownloadAssets(c *gin.Context) {
+	quality := 0
+	if value := c.Query("quality"); value != "" {
+		percentage, err := strconv.Atoi(value)
+		if err != nil || percentage < 1 || percentage > 100 {
+			c.JSON(400, gin.H{"message": "Quality must be between 1 and 100."})
+			return
+		}
+		quality = percentage
+	}
+
+	assets, status, err := h.downloadSelection(c)
+	if err != nil {
+		c.JSON(status, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="assets-%s.zip"`, time.Now().UTC().Format("20060102-150405")))
+	c.Status(200)
+
+	archive := zip.NewWriter(c.Writer)
+	manifest := downloadManifest{CreatedAt: time.Now().UTC(), Quality: quality, Assets: []downloadEntry{}}
+
+	for _, asset := range assets {
+		file, err := h.writeDownloadFile(c, archive, asset, quality)
+		if err != nil {
+			// The status is already sent, the truncated archive tells the client
+			fmt.Println("[ASSET DOWNLOAD] Error writing asset:", asset.Filename, err)
+			return
+		}
+		manifest.Assets = append(manifest.Assets, downloadEntry{Assets: asset, File: file})
+	}
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: manifest.CreatedAt})
+	if err == nil {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(manifest)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		fmt.Println("[ASSET DOWNLOAD] Error writing manifest:", err)
+	}
+}
+
+// downloadSelection resolves the assets of a download request. It returns
+// the HTTP status to answer with when the selection is invalid.
+func (h *AssetHandler) downloadSelection(c *gin.Context) ([]types.Assets, int, error) {
+	if filenames := c.QueryArray("filename"); len(filenames) > 0 {
+		if len(filenames) > MaxDownloadAssets {
+			return nil, 400, fmt.Errorf("At most %d assets can be downloaded at once.", MaxDownloadAssets)
+		}
+
+		assets := []types.Assets{}
+		seen := map[string]bool{}
+		for _, filename := range filenames {
+			if seen[filename] {
+				continue
+			}
+			seen[filename] = true
+
+			asset, err := h.service.GetAsset(filename)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, 404, fmt.Errorf("The requested %s was not found.", filename)
+			}
+			if err != nil {
+				return nil, 500, fmt.Errorf("Error fetching asset: %v", err)
+			}
+			assets = append(assets, asset)
+		}
+		return assets, 200, nil
+	}
+
+	filter, err := ParseAssetFilter(c)
+	if err != nil {
+		return nil, 400, fmt.Errorf("Invalid filter: %v", err)
+	}
+	filter.Limit, filter.Cursor = MaxPageLimit, ""
+
+	assets := []types.Assets{}
+	for {
+		page, err := h.service.repository.GetAllAssets(filter)
+		if err != nil {
+			return nil, 500, fmt.Errorf("Error fetching assets: %v", err)
+		}
+		if page.Total > MaxDownloadAssets {
+			return nil, 400, fmt.Errorf("The filter matches %d assets, at most %d can be downloaded at once.", page.Total, MaxDownloadAssets)
+		}
+
+		assets = append(assets, page.Assets...)
+		if page.NextCursor == "" {
+			return assets, 200, nil
+		}
+		filter.Cursor = page.NextCursor
+	}
+}
+
+// writeDownloadFile copies one asset into the archive and returns its path
+// there. Derivatives that can't be generated are replaced by the original.
+func (h *AssetHandler) writeDownloadFile(c *gin.Context, archive *zip.Writer, asset types.Assets, quality int) (string, error) {
+	key, name := asset.StorageKey, asset.Filename
+	if quality > 0 {
+		v := h.qualityVariant(asset, quality, "")
+		defer h.derivatives.Pin(v.Key)()
+		if err := h.ensureDerivative(c.Request.Context(), v); err != nil {
+			fmt.Println("[ASSET DOWNLOAD] Using original, derivative failed:", asset.Filename, err)
+		} else {
+			key, name = v.Key, path.Base(v.Key)
+		}
+	}
+
+	reader, _, err := h.Storage.Get(c.Request.Context(), key)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	// Images are compressed already, storing them saves the CPU
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: assetModTime(asset)})
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
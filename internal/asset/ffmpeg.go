@@ -0,0 +1,110 @@
+package asset
+
+import (
+	"fmt"
+	"github.com/disintegration/imaging"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ffmpegEncoders struct {
+	once sync.Once
+	list string
+}
+
+// FFmpegProcessor encodes every format by running the ffmpeg binary.
+type FFmpegProcessor struct{}
+
+func (p *FFmpegProcessor) Name() string {
+	return "ffmpeg"
+}
+
+func (p *FFmpegProcessor) CanEncode(ext string) bool {
+	switch ext {
+	case ".jpg", ".jpeg":
+		return hasFFmpegEncoder("mjpeg")
+	case ".png":
+		return hasFFmpegEncoder("png")
+	case ".webp":
+		return hasFFmpegEncoder("libwebp")
+	case ".avif":
+		return hasFFmpegEncoder("libaom-av1") || hasFFmpegEncoder("libsvtav1")
+	}
+	return false
+}
+
+func (p *FFmpegProcessor) Encode(img image.Image, ext string, quality int) ([]byte, error) {
+	quality = clampQuality(quality)
+
+	switch ext {
+	case ".jpg", ".jpeg":
+		// mjpeg qscale runs from 2 (best) to 31 (worst)
+		qscale := strconv.Itoa(31 - int(float64(quality)/100*29))
+		return encodeWithFFmpeg(flatten(img), ext, "-q:v", qscale)
+	case ".png":
+		return encodeWithFFmpeg(quantize(img, quality), ext, "-compression_level", "9")
+	case ".webp":
+		return encodeWithFFmpeg(img, ext, "-c:v", "libwebp", "-quality", strconv.Itoa(quality))
+	case ".avif":
+		// libaom crf runs from 0 (lossless) to 63 (worst)
+		crf := strconv.Itoa(63 - int(float64(quality)/100*63))
+		encoder := "libaom-av1"
+		if !hasFFmpegEncoder(encoder) {
+			encoder = "libsvtav1"
+		}
+		return encodeWithFFmpeg(img, ext, "-c:v", encoder, "-still-picture", "1", "-crf", crf)
+	default:
+		return nil, fmt.Errorf("unsupported file format: %s", ext)
+	}
+}
+
+func hasFFmpegEncoder(name string) bool {
+	ffmpegEncoders.once.Do(func() {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			return
+		}
+
+		output, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").CombinedOutput()
+		if err != nil {
+			return
+		}
+		ffmpegEncoders.list = string(output)
+	})
+
+	return strings.Contains(ffmpegEncoders.list, " "+name+" ")
+}
+
+func encodeWithFFmpeg(img image.Image, ext string, args ...string) ([]byte, error) {
+	_, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg is not installed: %v", err)
+	}
+
+	workDir, err := os.MkdirTemp("", "encode-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	inputPath := filepath.Join(workDir, "input.png")
+	outputPath := filepath.Join(workDir, "output"+ext)
+
+	if err := imaging.Save(img, inputPath); err != nil {
+		return nil, err
+	}
+
+	cmdArgs := append([]string{"-i", inputPath}, args...)
+	cmdArgs = append(cmdArgs, "-y", outputPath)
+
+	output, err := exec.Command("ffmpeg", cmdArgs...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %v, output: %s", err, string(output))
+	}
+
+	return os.ReadFile(outputPath)
+}
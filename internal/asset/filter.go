@@ -0,0 +1,311 @@
+package asset
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultPageLimit = 50
+const MaxPageLimit = 200
+
+// sortColumns maps the accepted sort values to the column and the cast used
+// when comparing against a cursor value.
+var sortColumns = map[string]struct {
+	column string
+	cast   string
+}{
+	"created_at": {"created_at", "timestamptz"},
+	"size":       {"size", "bigint"},
+	"name":       {"name", "text"},
+	"width":      {"COALESCE(width, 0)", "integer"},
+	"height":     {"COALESCE(height, 0)", "integer"},
+}
+
+// Orientations accepted by the orientation filter, on displayed dimensions
+var orientations = map[string]string{
+	"landscape": "width > height",
+	"portrait":  "height > width",
+	"square":    "width = height AND width > 0",
+}
+
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int    `json:"i"`
+}
+
+// ParseAssetFilter reads the listing filters, sort and cursor from the query.
+func ParseAssetFilter(c *gin.Context) (types.AssetFilter, error) {
+	filter := types.AssetFilter{
+		Creator:     c.Query("creator"),
+		Description: c.Query("description"),
+		Visibility:  c.Query("visibility"),
+		Orientation: strings.ToLower(c.Query("orientation")),
+		CameraMake:  c.Query("camera_make"),
+		CameraModel: c.Query("camera_model"),
+		ColorSpace:  c.Query("color_space"),
+		Tags:        utils.NormalizeTags(c.QueryArray("tag")),
+		Sort:        c.DefaultQuery("sort", "created_at"),
+		Order:       strings.ToLower(c.DefaultQuery("order", "desc")),
+		Cursor:      c.Query("cursor"),
+		Limit:       DefaultPageLimit,
+	}
+
+	if value := c.Query("type"); value != "" {
+		filter.Type = "." + strings.TrimPrefix(strings.ToLower(value), ".")
+	}
+
+	if filter.Visibility != "" && filter.Visibility != types.VisibilityPublic && filter.Visibility != types.VisibilityPrivate {
+		return filter, fmt.Errorf("visibility must be public or private")
+	}
+
+	if _, ok := sortColumns[filter.Sort]; !ok {
+		return filter, fmt.Errorf("sort must be one of created_at, size, name, width, height")
+	}
+	if _, ok := orientations[filter.Orientation]; filter.Orientation != "" && !ok {
+		return filter, fmt.Errorf("orientation must be landscape, portrait or square")
+	}
+	if filter.Order != "asc" && filter.Order != "desc" {
+		return filter, fmt.Errorf("order must be asc or desc")
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+		}
+		filter.Limit = limit
+	}
+
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{
+		{"created_from", &filter.CreatedAfter}, {"created_to", &filter.CreatedBefore},
+		{"taken_from", &filter.TakenAfter}, {"taken_to", &filter.TakenBefore},
+	} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := parseDate(value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be a date (2006-01-02) or RFC 3339 time", param.name)
+		}
+		*param.target = &parsed
+	}
+
+	for _, param := range []struct {
+		name   string
+		target **int64
+	}{{"min_size", &filter.MinSize}, {"max_size", &filter.MaxSize}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			return filter, fmt.Errorf("%s must be a positive number of bytes", param.name)
+		}
+		*param.target = &parsed
+	}
+
+	for _, param := range []struct {
+		name   string
+		target **int
+	}{{"min_width", &filter.MinWidth}, {"max_width", &filter.MaxWidth}, {"min_height", &filter.MinHeight}, {"max_height", &filter.MaxHeight}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return filter, fmt.Errorf("%s must be a positive number of pixels", param.name)
+		}
+		*param.target = &parsed
+	}
+
+	if value := c.Query("has_gps"); value != "" {
+		hasGPS, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("has_gps must be true or false")
+		}
+		filter.HasGPS = &hasGPS
+	}
+
+	if value := c.Query("collection"); value != "" {
+		collection, err := strconv.Atoi(value)
+		if err != nil || collection < 1 {
+			return filter, fmt.Errorf("collection must be a collection id")
+		}
+		filter.Collection = &collection
+	}
+
+	return filter, nil
+}
+
+// assetQuery collects WHERE conditions and their positional arguments.
+type assetQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (q *assetQuery) add(condition string, args ...interface{}) {
+	for _, arg := range args {
+		q.args = append(q.args, arg)
+		condition = strings.Replace(condition, "?", "$"+strconv.Itoa(len(q.args)), 1)
+	}
+	q.conditions = append(q.conditions, condition)
+}
+
+func (q *assetQuery) where() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+func buildAssetQuery(filter types.AssetFilter) *assetQuery {
+	q := &assetQuery{}
+
+	// Listings show either the live assets or the trash, never both
+	if filter.Trashed {
+		q.add("deleted_at IS NOT NULL")
+	} else {
+		q.add("deleted_at IS NULL")
+	}
+
+	if filter.Type != "" {
+		q.add("LOWER(type) = ?", filter.Type)
+	}
+	if filter.Creator != "" {
+		q.add("creator = ?", filter.Creator)
+	}
+	if filter.CreatedAfter != nil {
+		q.add("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		q.add("created_at < ?", *filter.CreatedBefore)
+	}
+	if filter.MinSize != nil {
+		q.add("size >= ?", *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		q.add("size <= ?", *filter.MaxSize)
+	}
+	if filter.Visibility != "" {
+		q.add("visibility = ?", filter.Visibility)
+	}
+	if filter.Description != "" {
+		q.add(`description ILIKE ? ESCAPE '\'`, "%"+escapeLike(filter.Description)+"%")
+	}
+	if filter.MinWidth != nil {
+		q.add("width >= ?", *filter.MinWidth)
+	}
+	if filter.MaxWidth != nil {
+		q.add("width <= ?", *filter.MaxWidth)
+	}
+	if filter.MinHeight != nil {
+		q.add("height >= ?", *filter.MinHeight)
+	}
+	if filter.MaxHeight != nil {
+		q.add("height <= ?", *filter.MaxHeight)
+	}
+	if condition, ok := orientations[filter.Orientation]; ok {
+		q.add(condition)
+	}
+	if filter.CameraMake != "" {
+		q.add(`camera_make ILIKE ? ESCAPE '\'`, "%"+escapeLike(filter.CameraMake)+"%")
+	}
+	if filter.CameraModel != "" {
+		q.add(`camera_model ILIKE ? ESCAPE '\'`, "%"+escapeLike(filter.CameraModel)+"%")
+	}
+	if filter.TakenAfter != nil {
+		q.add("taken_at >= ?", *filter.TakenAfter)
+	}
+	if filter.TakenBefore != nil {
+		q.add("taken_at < ?", *filter.TakenBefore)
+	}
+	if filter.HasGPS != nil {
+		if *filter.HasGPS {
+			q.add("gps_latitude IS NOT NULL")
+		} else {
+			q.add("gps_latitude IS NULL")
+		}
+	}
+	if filter.ColorSpace != "" {
+		q.add("LOWER(color_space) = LOWER(?)", filter.ColorSpace)
+	}
+	// Every tag must be on the asset
+	for _, tag := range filter.Tags {
+		q.add("EXISTS (SELECT 1 FROM asset_tags JOIN tags ON tags.id = asset_tags.tag_id WHERE asset_tags.asset_id = assets.id AND tags.name = ?)", tag)
+	}
+	if filter.Collection != nil {
+		q.add("EXISTS (SELECT 1 FROM collection_assets WHERE collection_assets.asset_id = assets.id AND collection_assets.collection_id = ?)", *filter.Collection)
+	}
+
+	return q
+}
+
+func encodeCursor(filter types.AssetFilter, asset types.Assets) string {
+	cursor := pageCursor{Sort: filter.Sort, Order: filter.Order, ID: asset.ID}
+
+	switch filter.Sort {
+	case "size":
+		cursor.Value = strconv.FormatInt(asset.Size, 10)
+	case "name":
+		cursor.Value = asset.Name
+	case "width":
+		cursor.Value = strconv.Itoa(asset.Metadata.Width)
+	case "height":
+		cursor.Value = strconv.Itoa(asset.Metadata.Height)
+	default:
+		cursor.Value = asset.CreatedAt
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(filter types.AssetFilter) (pageCursor, error) {
+	var cursor pageCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(filter.Cursor)
+	if err != nil {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+
+	if cursor.Sort != filter.Sort || cursor.Order != filter.Order {
+		return cursor, fmt.Errorf("cursor does not match the requested sort")
+	}
+
+	return cursor, nil
+}
+
+// parseDate accepts a plain date or a full RFC 3339 timestamp.
+func parseDate(value string) (time.Time, error) {
+	if parsed, err := time.Parse("2006-01-02", value); err == nil {
+		return parsed, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(value)
+}
@@ -0,0 +1,60 @@
+package asset
+
+import (
+	"encoding/base64"
+	"github.com/okanay/file-upload-go/types"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	asset := types.Assets{ID: 42, Name: "beach, sunset", Size: 123456, CreatedAt: "2024-05-01T10:00:00Z"}
+	asset.Metadata.Width, asset.Metadata.Height = 1920, 1080
+
+	tests := []struct {
+		sort  string
+		value string
+	}{
+		{"created_at", "2024-05-01T10:00:00Z"},
+		{"size", "123456"},
+		{"name", "beach, sunset"},
+		{"width", "1920"},
+		{"height", "1080"},
+	}
+
+	for _, tt := range tests {
+		for _, order := range []string{"asc", "desc"} {
+			filter := types.AssetFilter{Sort: tt.sort, Order: order}
+			filter.Cursor = encodeCursor(filter, asset)
+
+			cursor, err := decodeCursor(filter)
+			if err != nil {
+				t.Fatalf("%s %s: %v", tt.sort, order, err)
+			}
+			if cursor.ID != asset.ID || cursor.Value != tt.value {
+				t.Errorf("%s %s: got id %d value %q, want %d %q", tt.sort, order, cursor.ID, cursor.Value, asset.ID, tt.value)
+			}
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	asset := types.Assets{ID: 7, Size: 10}
+	cursor := encodeCursor(types.AssetFilter{Sort: "size", Order: "desc"}, asset)
+
+	tests := []struct {
+		name   string
+		filter types.AssetFilter
+	}{
+		{"other sort", types.AssetFilter{Sort: "name", Order: "desc", Cursor: cursor}},
+		{"other order", types.AssetFilter{Sort: "size", Order: "asc", Cursor: cursor}},
+		{"not base64", types.AssetFilter{Sort: "size", Order: "desc", Cursor: "not a cursor!"}},
+		{"not json", types.AssetFilter{Sort: "size", Order: "desc", Cursor: base64.RawURLEncoding.EncodeToString([]byte("size:10"))}},
+		{"padded base64", types.AssetFilter{Sort: "size", Order: "desc", Cursor: cursor + "=="}},
+	}
+
+	for _, tt := range tests {
+		if _, err := decodeCursor(tt.filter); err == nil {
+			t.Errorf("%s: cursor was accepted", tt.name)
+		}
+	}
+}
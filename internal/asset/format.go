@@ -0,0 +1,108 @@
+package asset
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatExtensions maps the values accepted by ?format= to the extension of
+// the derivative that is written for them.
+var FormatExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"jpg":  ".jpg",
+	"png":  ".png",
+	"webp": ".webp",
+	"avif": ".avif",
+}
+
+// Formats picked from the Accept header, in order of preference.
+var negotiableFormats = []struct {
+	mimeType string
+	ext      string
+}{
+	{"image/avif", ".avif"},
+	{"image/webp", ".webp"},
+}
+
+// NegotiateFormat returns the extension of the output format for a request,
+// or "" when the source format should be kept. An explicit format wins over
+// the Accept header.
+func NegotiateFormat(accept, explicit, sourceExt string) (string, error) {
+	if explicit != "" {
+		ext, ok := FormatExtensions[strings.ToLower(explicit)]
+		if !ok {
+			return "", fmt.Errorf("format must be one of jpeg, png, webp, avif")
+		}
+		if !CanEncode(ext) {
+			return "", fmt.Errorf("format %s is not available on this server", explicit)
+		}
+		if sameFormat(ext, sourceExt) {
+			return "", nil
+		}
+		return ext, nil
+	}
+
+	accepted := parseAccept(accept)
+	for _, format := range negotiableFormats {
+		if !accepted[format.mimeType] {
+			continue
+		}
+		if sameFormat(format.ext, sourceExt) {
+			return "", nil
+		}
+		if CanEncode(format.ext) {
+			return format.ext, nil
+		}
+	}
+
+	return "", nil
+}
+
+// CanEncode reports whether derivatives can be written in the given format.
+func CanEncode(ext string) bool {
+	return processor.CanEncode(ext)
+}
+
+// outputExt is the extension a derivative is written in, the negotiated
+// format or the source's own when format is "".
+func outputExt(format, sourceExt string) string {
+	if format != "" {
+		return format
+	}
+	return strings.ToLower(sourceExt)
+}
+
+func parseAccept(header string) map[string]bool {
+	accepted := make(map[string]bool)
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		mimeType := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		rejected := false
+		for _, param := range fields[1:] {
+			param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+			if param == "q=0" || param == "q=0.0" || param == "q=0.00" || param == "q=0.000" {
+				rejected = true
+			}
+		}
+
+		if mimeType != "" && !rejected {
+			accepted[mimeType] = true
+		}
+	}
+
+	return accepted
+}
+
+func sameFormat(a, b string) bool {
+	return normalizeExt(a) == normalizeExt(b)
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ext == ".jpeg" {
+		return ".jpg"
+	}
+	return ext
+}
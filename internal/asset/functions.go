@@ -1,114 +1,88 @@
 package asset
 
 import (
-	"errors"
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/disintegration/imaging"
-	"github.com/okanay/file-upload-go/utils"
-	"os"
-	"os/exec"
+	"github.com/okanay/file-upload-go/storage"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/metadata"
+	"mime"
+	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
-func OptimizeImage(publicDir, optimizedDir, filename string, quality int) error {
-	// Check if directories exist
-	if _, err := os.Stat(publicDir); os.IsNotExist(err) {
-		return fmt.Errorf("public directory does not exist: %s", publicDir)
-	}
-	if _, err := os.Stat(optimizedDir); os.IsNotExist(err) {
-		return fmt.Errorf("optimized images directory does not exist: %s", optimizedDir)
-	}
-
-	inputPath := filepath.Join(publicDir, filename)
-	if !utils.FileIsExist(inputPath) {
-		return fmt.Errorf("input file does not exist: %s", inputPath)
-	}
+// OptimizeImage re-encodes the original at the given quality with the
+// configured ImageProcessor, in format or in its own format when format is "".
+func OptimizeImage(store storage.Storage, optimizedDir string, asset types.Assets, quality int, format string) error {
+	ctx := context.Background()
+	filename := asset.Filename
 
-	optimizedFilename := CreateOptimizedFileName(filename, quality)
-	outputPath := filepath.Join(optimizedDir, optimizedFilename)
+	optimizedFilename := CreateTransformedFileName(DerivativeName(asset), TransformOptions{Quality: quality, Format: format})
+	outputKey := path.Join(optimizedDir, optimizedFilename)
 
-	err := os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("failed to create output directory: %v", err)
-	}
-
-	if utils.FileIsExist(outputPath) {
+	if storage.Exists(ctx, store, outputKey) {
 		return nil // Dosya zaten var, işlem yapmaya gerek yok
 	}
 
-	ext := filepath.Ext(filename)
-	var cmd *exec.Cmd
-
-	switch strings.ToLower(ext) {
-	case ".jpg", ".jpeg":
-		ffmpegQuality := 31 - int(float64(quality)/100*29)
-		cmd = exec.Command("ffmpeg",
-			"-i", inputPath,
-			"-q:v", strconv.Itoa(ffmpegQuality),
-			"-y",
-			outputPath,
-		)
-	case ".png":
-		scale := float64(quality) / 100
-		cmd = exec.Command("ffmpeg",
-			"-i", inputPath,
-			"-vf", fmt.Sprintf("scale=iw*%f:-1", scale),
-			"-y",
-			outputPath,
-		)
-	case ".webp":
-		cmd = exec.Command("ffmpeg",
-			"-i", inputPath,
-			"-c:v", "libwebp",
-			"-quality", strconv.Itoa(quality),
-			"-y",
-			outputPath,
-		)
-	default:
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !isSupportedExt(ext) {
 		return fmt.Errorf("unsupported file format: %s", ext)
 	}
+	if format != "" {
+		ext = format
+	}
+	if !processor.CanEncode(ext) {
+		return fmt.Errorf("the %s image processor can't encode %s", processor.Name(), ext)
+	}
 
-	// before running the command, check if ffmpeg is installed
-	_, err = exec.LookPath("ffmpeg")
+	reader, _, err := store.Get(ctx, asset.StorageKey)
 	if err != nil {
-		fmt.Println("OPTIMIZE IMAGE ERROR: ", "ffmpeg is not installed")
-		return fmt.Errorf("ffmpeg is not installed: %v", err)
+		return fmt.Errorf("input file does not exist: %s", filename)
 	}
+	defer reader.Close()
 
-	output, err := cmd.CombinedOutput()
+	srcImage, err := metadata.Decode(reader, imaging.AutoOrientation(true))
 	if err != nil {
-		return fmt.Errorf("ffmpeg failed: %v, output: %s", err, string(output))
+		return fmt.Errorf("failed to decode image: %v", err)
 	}
 
-	fmt.Println("[OPTIMIZE IMAGE] ", outputPath)
-	return nil
-}
-
-func BlurImage(publicDir, blurDir, filename string) error {
-	// Check if the directories exist
-	if _, err := os.Stat(publicDir); os.IsNotExist(err) {
-		return errors.New("public directory does not exist")
+	data, err := processor.Encode(srcImage, ext, quality)
+	if err != nil {
+		return err
 	}
-	if _, err := os.Stat(blurDir); os.IsNotExist(err) {
-		return errors.New("blur directory does not exist")
+
+	err = store.Put(ctx, outputKey, bytes.NewReader(data), int64(len(data)), mime.TypeByExtension(ext))
+	if err != nil {
+		return fmt.Errorf("failed to store optimized image: %v", err)
 	}
 
-	normalPath := filepath.Join(publicDir, filename)
-	blurredPath := filepath.Join(blurDir, filename)
+	fmt.Println("[OPTIMIZE IMAGE] ", outputKey)
+	return nil
+}
 
-	// Check if the original file exists
-	if _, err := os.Stat(normalPath); os.IsNotExist(err) {
-		return errors.New("original file does not exist")
-	}
+// BlurImage writes a small blurred preview of the original, in format or in
+// its own format when format is "".
+func BlurImage(store storage.Storage, blurDir string, asset types.Assets, format string) error {
+	ctx := context.Background()
+	filename := asset.Filename
+	blurredKey := path.Join(blurDir, CreateTransformedFileName(DerivativeName(asset), TransformOptions{Format: format}))
 
 	// Check if the blurred image already exists
-	if _, err := os.Stat(blurredPath); err == nil {
+	if storage.Exists(ctx, store, blurredKey) {
 		return nil // Blurred image already exists, no need to recreate
 	}
 
-	srcImage, err := imaging.Open(normalPath)
+	// Check if the original file exists
+	reader, _, err := store.Get(ctx, asset.StorageKey)
+	if err != nil {
+		return fmt.Errorf("original file does not exist")
+	}
+	defer reader.Close()
+
+	srcImage, err := metadata.Decode(reader, imaging.AutoOrientation(true))
 	if err != nil {
 		return err
 	}
@@ -116,11 +90,20 @@ func BlurImage(publicDir, blurDir, filename string) error {
 	blurredImage := imaging.Blur(srcImage, 20.0)
 	resizeImage := imaging.Resize(blurredImage, 50, 0, imaging.Lanczos)
 
-	err = imaging.Save(resizeImage, blurredPath)
+	ext := strings.ToLower(filepath.Ext(filename))
+	if format != "" {
+		ext = format
+	}
+	data, err := processor.Encode(resizeImage, ext, DefaultQuality)
+	if err != nil {
+		return err
+	}
+
+	err = store.Put(ctx, blurredKey, bytes.NewReader(data), int64(len(data)), mime.TypeByExtension(ext))
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("[BLUR IMAGE] ", blurredPath)
+	fmt.Println("[BLUR IMAGE] ", blurredKey)
 	return nil
 }
@@ -0,0 +1,142 @@
+package asset
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/types"
+	"image"
+	"net/http/httptest"
+	"testing"
+)
+
+// encodeAll stands in for the configured processor so format negotiation
+// does not depend on ffmpeg being installed.
+type encodeAll struct{}
+
+func (encodeAll) Name() string                                    { return "test" }
+func (encodeAll) CanEncode(ext string) bool                       { return true }
+func (encodeAll) Encode(image.Image, string, int) ([]byte, error) { return nil, nil }
+
+func TestResolveVariant(t *testing.T) {
+	saved := processor
+	processor = encodeAll{}
+	defer func() { processor = saved }()
+
+	h := &AssetHandler{BlurDir: "blur", OptimizedDir: "optimized"}
+	asset := types.Assets{Filename: "a1b2c3d4.jpg", MimeType: "image/jpeg", StorageKey: "a1b2c3d4.jpg"}
+
+	const browser = "image/avif,image/webp,image/apng,image/*,*/*;q=0.8"
+
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		kind   string
+		key    string
+		status int
+	}{
+		{"original", "", "", KindOriginal, "a1b2c3d4.jpg", 0},
+		{"original for a browser is converted", "", browser, KindOptimized, "optimized/a1b2c3d4-jpg.avif", 0},
+		{"quality", "quality=60", "", KindOptimized, "optimized/a1b2c3d4-60.jpg", 0},
+		{"quality for a browser stays a quality variant", "quality=60", browser, KindOptimized, "optimized/a1b2c3d4-jpg-60.avif", 0},
+		{"blur", "blur=yes", "", KindBlur, "blur/a1b2c3d4.jpg", 0},
+		{"blur for a browser stays a blur variant", "blur=yes", browser, KindBlur, "blur/a1b2c3d4-jpg.avif", 0},
+		{"explicit format beats accept", "blur=yes&format=webp", browser, KindBlur, "blur/a1b2c3d4-jpg.webp", 0},
+		{"explicit source format keeps it", "quality=60&format=jpeg", browser, KindOptimized, "optimized/a1b2c3d4-60.jpg", 0},
+		{"resize", "w=300", "", KindOptimized, "optimized/a1b2c3d4-w300.jpg", 0},
+		{"resize wins over blur", "w=300&blur=yes", browser, KindOptimized, "optimized/a1b2c3d4-w300-jpg.avif", 0},
+		{"version for a browser", "version=1", browser, KindOriginal, "a1b2c3d4.jpg", 0},
+		{"version with quality", "version=1&quality=60", "", "", "", 400},
+		{"invalid width", "w=abc", "", "", "", 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/assets/"+asset.Filename+"?"+tt.query, nil)
+			if tt.accept != "" {
+				c.Request.Header.Set("Accept", tt.accept)
+			}
+
+			v, err := h.resolveVariant(c, asset)
+			if tt.status != 0 {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Kind != tt.kind || v.Key != tt.key {
+				t.Errorf("got %s %s, want %s %s", v.Kind, v.Key, tt.kind, tt.key)
+			}
+		})
+	}
+}
+
+func TestDerivativeKeysFollowContent(t *testing.T) {
+	h := &AssetHandler{BlurDir: "blur", OptimizedDir: "optimized"}
+	before := types.Assets{Filename: "a1b2c3d4.jpg", Hash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}
+	after := types.Assets{Filename: "a1b2c3d4.jpg", Hash: "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"}
+
+	if got := h.qualityVariant(before, 60, "").Key; got != "optimized/a1b2c3d4-9f86d081884c7d65-60.jpg" {
+		t.Errorf("unexpected key %s", got)
+	}
+
+	for _, variants := range [][2]variant{
+		{h.qualityVariant(before, 60, ""), h.qualityVariant(after, 60, "")},
+		{h.blurVariant(before, ".webp"), h.blurVariant(after, ".webp")},
+		{h.transformVariant(before, TransformOptions{Width: 300}), h.transformVariant(after, TransformOptions{Width: 300})},
+	} {
+		if variants[0].Key == variants[1].Key {
+			t.Errorf("derivatives of different content share the key %s", variants[0].Key)
+		}
+	}
+}
+
+func TestResolveVariantWithoutEncoder(t *testing.T) {
+	saved := processor
+	processor = &GoProcessor{}
+	defer func() { processor = saved }()
+
+	h := &AssetHandler{BlurDir: "blur", OptimizedDir: "optimized"}
+	asset := types.Assets{Filename: "a1b2c3d4.webp", MimeType: "image/webp", StorageKey: "a1b2c3d4.webp"}
+
+	tests := []struct {
+		name      string
+		query     string
+		kind      string
+		key       string
+		unchanged bool
+		status    int
+	}{
+		{"quality is served as uploaded", "quality=60", KindOriginal, "a1b2c3d4.webp", true, 0},
+		{"quality converted to an encodable format", "quality=60&format=jpeg", KindOptimized, "optimized/a1b2c3d4-webp-60.jpg", false, 0},
+		{"resize is rejected", "w=300", "", "", false, 400},
+		{"resize with quality is rejected", "w=300&quality=60", "", "", false, 400},
+		{"explicit webp is rejected", "format=webp", "", "", false, 400},
+		{"blur is rejected", "blur=yes", "", "", false, 400},
+		{"blur converted to an encodable format", "blur=yes&format=png", KindBlur, "blur/a1b2c3d4-webp.png", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/assets/"+asset.Filename+"?"+tt.query, nil)
+
+			v, err := h.resolveVariant(c, asset)
+			if tt.status != 0 {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Kind != tt.kind || v.Key != tt.key || v.QualityUnchanged != tt.unchanged {
+				t.Errorf("got %s %s %v, want %s %s %v", v.Kind, v.Key, v.QualityUnchanged, tt.kind, tt.key, tt.unchanged)
+			}
+		})
+	}
+}
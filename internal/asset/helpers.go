@@ -2,12 +2,81 @@ package asset
 
 import (
 	"fmt"
+	"github.com/okanay/file-upload-go/types"
 	"path/filepath"
 	"strings"
 )
 
+// ContentHashLength is how much of the content hash goes into derivative
+// names.
+const ContentHashLength = 16
+
+// DerivativeName is the name derivatives of an asset are built from, its
+// filename with a token of the content hash, (12345678-9f86d081884c7d65.jpg).
+// Derivatives of replaced content can never be served for the new content,
+// even when written after the replacement. Legacy assets without a hash keep
+// the plain filename.
+func DerivativeName(asset types.Assets) string {
+	if len(asset.Hash) < ContentHashLength {
+		return asset.Filename
+	}
+	ext := filepath.Ext(asset.Filename)
+	return strings.TrimSuffix(asset.Filename, ext) + "-" + asset.Hash[:ContentHashLength] + ext
+}
+
 func CreateOptimizedFileName(filename string, quality int) string {
 	ext := filepath.Ext(filename)
 	baseName := strings.TrimSuffix(filename, ext)
 	return fmt.Sprintf("%s-%d%s", baseName, quality, ext)
 }
+
+// CreateTransformedFileName builds the derivative name for a transformation,
+// e.g. (12345678-w600-h400-cover-center-80.jpg). A format conversion keeps
+// the source extension as a token, (12345678-w600-jpg-80.webp), so it never
+// collides with derivatives of an original stored in the target format. The
+// quality suffix follows CreateOptimizedFileName.
+func CreateTransformedFileName(filename string, opts TransformOptions) string {
+	ext := filepath.Ext(filename)
+	parts := []string{strings.TrimSuffix(filename, ext)}
+
+	if opts.Width > 0 {
+		parts = append(parts, fmt.Sprintf("w%d", opts.Width))
+	}
+	if opts.Height > 0 {
+		parts = append(parts, fmt.Sprintf("h%d", opts.Height))
+	}
+	if opts.Fit != "" {
+		parts = append(parts, opts.Fit)
+	}
+	if opts.Crop != "" {
+		parts = append(parts, opts.Crop)
+	}
+
+	if opts.Format != "" {
+		parts = append(parts, strings.TrimPrefix(strings.ToLower(ext), "."))
+		ext = opts.Format
+	}
+
+	name := strings.Join(parts, "-") + ext
+	if opts.Quality > 0 {
+		return CreateOptimizedFileName(name, opts.Quality)
+	}
+	return name
+}
+
+func isSupportedExt(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".png", ".webp":
+		return true
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
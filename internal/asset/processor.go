@@ -0,0 +1,165 @@
+package asset
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/disintegration/imaging"
+	"image"
+	"image/color"
+	"image/png"
+	"sort"
+	"strings"
+)
+
+// ImageProcessor encodes the images written for derivatives. Quality runs
+// from 1 to 100 for every format, higher means closer to the original and
+// larger files.
+type ImageProcessor interface {
+	Name() string
+	CanEncode(ext string) bool
+	Encode(img image.Image, ext string, quality int) ([]byte, error)
+}
+
+// Processors are the selectable backends, by the name used in
+// IMAGE_PROCESSOR.
+var Processors = map[string]func() ImageProcessor{
+	"go":     func() ImageProcessor { return &GoProcessor{} },
+	"ffmpeg": func() ImageProcessor { return &FFmpegProcessor{} },
+}
+
+const DefaultProcessor = "go"
+
+var processor = Processors[DefaultProcessor]()
+
+// SetImageProcessor selects the backend used for all derivatives.
+func SetImageProcessor(name string) error {
+	if name == "" {
+		name = DefaultProcessor
+	}
+
+	newProcessor, ok := Processors[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(Processors))
+		for name := range Processors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("image processor must be one of %s", strings.Join(names, ", "))
+	}
+
+	processor = newProcessor()
+	return nil
+}
+
+// GoProcessor encodes JPEG and PNG with the standard library and never runs
+// an external program. Go can't write WebP and AVIF, derivatives in those
+// formats need IMAGE_PROCESSOR=ffmpeg.
+type GoProcessor struct{}
+
+func (p *GoProcessor) Name() string {
+	return "go"
+}
+
+func (p *GoProcessor) CanEncode(ext string) bool {
+	switch ext {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+func (p *GoProcessor) Encode(img image.Image, ext string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	quality = clampQuality(quality)
+
+	switch ext {
+	case ".jpg", ".jpeg":
+		err := imaging.Encode(&buf, flatten(img), imaging.JPEG, imaging.JPEGQuality(quality))
+		return buf.Bytes(), err
+	case ".png":
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err := encoder.Encode(&buf, quantize(img, quality))
+		return buf.Bytes(), err
+	}
+
+	return nil, fmt.Errorf("unsupported file format: %s", ext)
+}
+
+func clampQuality(quality int) int {
+	if quality == 0 {
+		return DefaultQuality
+	}
+	return max(1, min(quality, 100))
+}
+
+// flatten draws transparent images on white, JPEG would turn them black.
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	background := imaging.New(bounds.Dx(), bounds.Dy(), color.White)
+	return imaging.Overlay(background, img, image.Pt(0, 0), 1.0)
+}
+
+// quantize gives quality a meaning for lossless PNG: below 100 the image
+// is reduced to a palette of up to 256 colors, fewer for lower qualities, and
+// written as an 8-bit paletted PNG. Colors are bucketed at 5 bits per channel
+// plus 3 bits of alpha, and the most common buckets become the palette.
+func quantize(img image.Image, quality int) image.Image {
+	if quality >= 100 {
+		return img
+	}
+
+	src := imaging.Clone(img)
+	const buckets = 1 << 18
+
+	counts := make([]uint32, buckets)
+	sums := make([][4]uint64, buckets)
+	for i := 0; i < len(src.Pix); i += 4 {
+		b := colorBucket(src.Pix[i : i+4])
+		counts[b]++
+		for c := 0; c < 4; c++ {
+			sums[b][c] += uint64(src.Pix[i+c])
+		}
+	}
+
+	used := make([]int, 0, 1024)
+	for b, count := range counts {
+		if count > 0 {
+			used = append(used, b)
+		}
+	}
+	sort.Slice(used, func(i, j int) bool { return counts[used[i]] > counts[used[j]] })
+
+	size := min(len(used), max(2, quality*256/100))
+	palette := make(color.Palette, size)
+	for i, b := range used[:size] {
+		n := uint64(counts[b])
+		palette[i] = color.NRGBA{uint8(sums[b][0] / n), uint8(sums[b][1] / n), uint8(sums[b][2] / n), uint8(sums[b][3] / n)}
+	}
+
+	// Every pixel of a bucket maps to the same palette entry
+	index := make([]int16, buckets)
+	for i := range index {
+		index[i] = -1
+	}
+
+	dst := image.NewPaletted(src.Rect, palette)
+	for y := 0; y < src.Rect.Dy(); y++ {
+		for x := 0; x < src.Rect.Dx(); x++ {
+			i := y*src.Stride + x*4
+			b := colorBucket(src.Pix[i : i+4])
+			if index[b] < 0 {
+				index[b] = int16(palette.Index(color.NRGBA{src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3]}))
+			}
+			dst.Pix[y*dst.Stride+x] = uint8(index[b])
+		}
+	}
+	return dst
+}
+
+func colorBucket(pix []uint8) int {
+	return int(pix[0]>>3)<<13 | int(pix[1]>>3)<<8 | int(pix[2]>>3)<<3 | int(pix[3]>>5)
+}
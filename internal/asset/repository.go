@@ -2,7 +2,16 @@ package asset
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/okanay/file-upload-go/storage"
 	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
 type Repository struct {
@@ -10,57 +19,748 @@ type Repository struct {
 }
 
 type IRepository interface {
-	GetAllAssets() ([]types.Assets, error)
+	GetAllAssets(filter types.AssetFilter) (types.AssetPage, error)
+	SearchAssets(filter types.AssetFilter, query string, offset int) (types.SearchPage, error)
 	GetAssetWithFilename(filename string) (types.Assets, error)
-	DeleteAsset(filename string) error
+	GetTrashedAsset(filename string) (types.Assets, error)
+	GetExpiredTrash(before time.Time, limit int) ([]types.Assets, error)
+	TrashAsset(filename string, move MoveFunc) error
+	RestoreAsset(filename string, move MoveFunc) error
+	PurgeAsset(filename string) ([]string, error)
+	AdoptBlob(filename, hash string, size int64, mimeType string) (string, error)
+	ReplaceAssetContent(filename string, content types.CreateAssetReq, replacedBy string) (types.Assets, string, error)
+	RevertAsset(filename string, version int, replacedBy string) (types.Assets, error)
+	GetAssetVersions(assetID int) ([]types.AssetVersion, error)
+	GetAssetVersion(assetID, version int) (types.AssetVersion, error)
+	GetAssetsToBackfill(afterID, limit int) ([]types.Assets, error)
+	UpdateAsset(filename string, req types.UpdateAssetReq, revision int) (types.Assets, error)
+	AddAssetTags(filename string, tags []string) (types.Assets, error)
+	RemoveAssetTags(filename string, tags []string) (types.Assets, error)
+	GetTags() ([]types.Tag, error)
+	UpdateAssetPlaceholders(id int, blurHash, thumbHash string) error
+	UpdateAssetMetadata(id int, meta types.ImageMetadata) error
 }
 
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) GetAllAssets() ([]types.Assets, error) {
-	var assets []types.Assets
+// GetAllAssets returns one page of assets matching the filter using keyset
+// pagination on the sort column, with the id as tie breaker.
+func (r *Repository) GetAllAssets(filter types.AssetFilter) (types.AssetPage, error) {
+	page := types.AssetPage{Assets: []types.Assets{}}
 
-	query := `SELECT id, creator, name, type, filename, description, size, created_at, updated_at FROM assets`
+	q := buildAssetQuery(filter)
 
-	rows, err := r.db.Query(query)
+	countQuery := `SELECT COUNT(*) FROM assets` + q.where()
+	if err := r.db.QueryRow(countQuery, q.args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	sort := sortColumns[filter.Sort]
+	direction, comparison := "DESC", "<"
+	if filter.Order == "asc" {
+		direction, comparison = "ASC", ">"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter)
+		if err != nil {
+			return page, httperrors.NewHttpError(err.Error(), http.StatusBadRequest)
+		}
+		q.add(fmt.Sprintf("(%s, id) %s (?::%s, ?)", sort.column, comparison, sort.cast), cursor.Value, cursor.ID)
+	}
+
+	// One extra row tells whether there is a next page
+	args := append(q.args, storage.TrashDir)
+	query := fmt.Sprintf(`SELECT %s FROM assets%s ORDER BY %s %s, id %s LIMIT %d`,
+		types.AssetColumns(len(args)), q.where(), sort.column, direction, direction, filter.Limit+1)
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return assets, err
+		return page, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var asset types.Assets
-		if err := rows.Scan(&asset.ID, &asset.Creator, &asset.Name, &asset.Type, &asset.Filename, &asset.Description, &asset.Size, &asset.CreatedAt, &asset.UpdatedAt); err != nil {
-			return assets, err
+		if err := rows.Scan(asset.ScanFields()...); err != nil {
+			return page, err
 		}
-		assets = append(assets, asset)
+		page.Assets = append(page.Assets, asset)
+	}
+
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Assets) > filter.Limit {
+		page.Assets = page.Assets[:filter.Limit]
+		page.NextCursor = encodeCursor(filter, page.Assets[filter.Limit-1])
+	}
+
+	return page, nil
+}
+
+// SearchAssets returns one page of the assets matching a tsquery and the
+// filter, best ranked first. The search document of an asset is kept in
+// asset_search by triggers.
+func (r *Repository) SearchAssets(filter types.AssetFilter, query string, offset int) (types.SearchPage, error) {
+	page := types.SearchPage{Results: []types.SearchResult{}}
+
+	q := buildAssetQuery(filter)
+	q.add("asset_search.document @@ to_tsquery('simple', ?)", query)
+	queryParam := len(q.args)
+
+	from := ` FROM assets JOIN asset_search ON asset_search.asset_id = assets.id`
+
+	countQuery := `SELECT COUNT(*)` + from + q.where()
+	if err := r.db.QueryRow(countQuery, q.args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	headlines := make([]string, len(searchFields))
+	for i, field := range searchFields {
+		headlines[i] = searchHeadline(field.column, queryParam)
+	}
+
+	// One extra row tells whether there is a next page
+	args := append(q.args, storage.TrashDir)
+	selectQuery := fmt.Sprintf(`SELECT %s, ts_rank(asset_search.document, to_tsquery('simple', $%d)) AS rank, %s%s%s
+		ORDER BY rank DESC, id DESC LIMIT %d OFFSET %d`,
+		types.AssetColumns(len(args)), queryParam, strings.Join(headlines, ", "), from, q.where(), filter.Limit+1, offset)
+
+	rows, err := r.db.Query(selectQuery, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result := types.SearchResult{Highlights: map[string]string{}}
+		snippets := make([]string, len(searchFields))
+
+		fields := append(result.Asset.ScanFields(), &result.Rank)
+		for i := range snippets {
+			fields = append(fields, &snippets[i])
+		}
+		if err := rows.Scan(fields...); err != nil {
+			return page, err
+		}
+
+		// ts_headline returns the start of a text without matches as well
+		for i, field := range searchFields {
+			if strings.Contains(snippets[i], markStart) {
+				result.Highlights[field.name] = markHeadline(snippets[i])
+			}
+		}
+		page.Results = append(page.Results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Results) > filter.Limit {
+		page.Results = page.Results[:filter.Limit]
+		page.NextOffset = offset + filter.Limit
+	}
+
+	return page, nil
+}
+
+// MoveFunc moves a file in storage, it must succeed when the file is
+// already at its destination.
+type MoveFunc func(from, to string) error
+
+// TrashAsset marks an asset as deleted. When no live asset or version uses
+// its content any more, the blob is given a key in the trash folder and its
+// file is moved there with move before the change is committed, so a failed
+// move leaves the asset untouched.
+func (r *Repository) TrashAsset(filename string, move MoveFunc) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hash sql.NullString
+	err = tx.QueryRow(`UPDATE assets SET deleted_at = NOW() WHERE filename = $1 AND deleted_at IS NULL RETURNING hash`, filename).Scan(&hash)
+	if err != nil {
+		return err
+	}
+
+	// Assets uploaded before deduplication own their file
+	if !hash.Valid {
+		return commitMove(tx, move, filename, trashKey(filename))
+	}
+
+	// The blob row is locked first so concurrent trashes agree on the count
+	var storageKey string
+	err = tx.QueryRow(`SELECT storage_key FROM blobs WHERE hash = $1 FOR UPDATE`, hash.String).Scan(&storageKey)
+	if err != nil {
+		return err
+	}
+
+	var live int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM assets WHERE deleted_at IS NULL
+		AND (hash = $1 OR id IN (SELECT asset_id FROM asset_versions WHERE hash = $1))`, hash.String).Scan(&live)
+	if err != nil {
+		return err
+	}
+	if live > 0 || strings.HasPrefix(storageKey, trashKey("")) {
+		return tx.Commit()
 	}
 
-	return assets, nil
+	_, err = tx.Exec(`UPDATE blobs SET storage_key = $2 WHERE hash = $1`, hash.String, trashKey(storageKey))
+	if err != nil {
+		return err
+	}
+
+	return commitMove(tx, move, storageKey, trashKey(storageKey))
 }
 
-func (r *Repository) DeleteAsset(filename string) error {
-	query := `DELETE FROM assets WHERE filename = $1`
+// RestoreAsset brings a trashed asset back. Like TrashAsset it moves the
+// file out of the trash folder with move before committing, if it was there.
+func (r *Repository) RestoreAsset(filename string, move MoveFunc) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hash sql.NullString
+	err = tx.QueryRow(`UPDATE assets SET deleted_at = NULL WHERE filename = $1 AND deleted_at IS NOT NULL RETURNING hash`, filename).Scan(&hash)
+	if err != nil {
+		return err
+	}
+
+	if !hash.Valid {
+		return commitMove(tx, move, trashKey(filename), filename)
+	}
+
+	var storageKey string
+	err = tx.QueryRow(`SELECT storage_key FROM blobs WHERE hash = $1 FOR UPDATE`, hash.String).Scan(&storageKey)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(storageKey, trashKey("")) {
+		return tx.Commit()
+	}
 
-	_, err := r.db.Exec(query, filename)
+	restoredKey := strings.TrimPrefix(storageKey, trashKey(""))
+	_, err = tx.Exec(`UPDATE blobs SET storage_key = $2 WHERE hash = $1`, hash.String, restoredKey)
 	if err != nil {
 		return err
 	}
 
+	return commitMove(tx, move, storageKey, restoredKey)
+}
+
+// commitMove moves a file while the rows pointing to it are still locked and
+// commits only when the move succeeded. The file is moved back when the
+// commit fails.
+func commitMove(tx *sql.Tx, move MoveFunc, from, to string) error {
+	if err := move(from, to); err != nil {
+		return fmt.Errorf("moving %s to %s: %w", from, to, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		if err := move(to, from); err != nil {
+			fmt.Println("[ASSET REPOSITORY] Error moving file back:", to, err)
+		}
+		return err
+	}
+
 	return nil
 }
 
+// PurgeAsset removes a trashed asset row with its versions and drops their
+// references on the blobs. It returns the storage keys that are no longer
+// used, blobs without references and archived originals.
+func (r *Repository) PurgeAsset(filename string) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	var hash, archiveKey sql.NullString
+	err = tx.QueryRow(`DELETE FROM assets WHERE filename = $1 AND deleted_at IS NOT NULL RETURNING id, hash, archive_key`, filename).Scan(&id, &hash, &archiveKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The versions are gone with the asset, their references are released here
+	hashes := []string{}
+	keys := []string{}
+	rows, err := tx.Query(`SELECT hash, COALESCE(archive_key, '') FROM asset_versions WHERE asset_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var versionHash, versionArchive string
+		if err := rows.Scan(&versionHash, &versionArchive); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hashes = append(hashes, versionHash)
+		keys = appendKey(keys, versionArchive)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keys = appendKey(keys, archiveKey.String)
+	if hash.Valid {
+		hashes = append(hashes, hash.String)
+	} else {
+		// Assets uploaded before deduplication own their file
+		keys = appendKey(keys, trashKey(filename))
+	}
+
+	for _, blobHash := range hashes {
+		var refCount int
+		var storageKey string
+		err = tx.QueryRow(`UPDATE blobs SET ref_count = ref_count - 1 WHERE hash = $1 RETURNING ref_count, storage_key`, blobHash).Scan(&refCount, &storageKey)
+		if err != nil {
+			return nil, err
+		}
+		if refCount > 0 {
+			continue
+		}
+
+		if _, err := tx.Exec(`DELETE FROM blobs WHERE hash = $1`, blobHash); err != nil {
+			return nil, err
+		}
+		keys = appendKey(keys, storageKey)
+	}
+
+	return keys, tx.Commit()
+}
+
+func appendKey(keys []string, key string) []string {
+	if key == "" || slices.Contains(keys, key) {
+		return keys
+	}
+	return append(keys, key)
+}
+
+func trashKey(key string) string {
+	return storage.TrashDir + "/" + key
+}
+
+// GetAssetWithFilename returns a live asset, trashed assets are not found.
 func (r *Repository) GetAssetWithFilename(filename string) (types.Assets, error) {
 	var asset types.Assets
 
-	query := `SELECT id, creator, name, type, filename, description, size, created_at, updated_at FROM assets WHERE filename = $1`
+	query := `SELECT ` + types.AssetColumns(2) + ` FROM assets WHERE filename = $1 AND deleted_at IS NULL`
 
-	err := r.db.QueryRow(query, filename).Scan(&asset.ID, &asset.Creator, &asset.Name, &asset.Type, &asset.Filename, &asset.Description, &asset.Size, &asset.CreatedAt, &asset.UpdatedAt)
+	err := r.db.QueryRow(query, filename, storage.TrashDir).Scan(asset.ScanFields()...)
 	if err != nil {
 		return asset, err
 	}
 
 	return asset, nil
 }
+
+func (r *Repository) GetTrashedAsset(filename string) (types.Assets, error) {
+	var asset types.Assets
+
+	query := `SELECT ` + types.AssetColumns(2) + ` FROM assets WHERE filename = $1 AND deleted_at IS NOT NULL`
+
+	err := r.db.QueryRow(query, filename, storage.TrashDir).Scan(asset.ScanFields()...)
+	if err != nil {
+		return asset, err
+	}
+
+	return asset, nil
+}
+
+// GetExpiredTrash returns up to limit assets trashed before the given time.
+func (r *Repository) GetExpiredTrash(before time.Time, limit int) ([]types.Assets, error) {
+	var assets []types.Assets
+
+	query := `SELECT ` + types.AssetColumns(3) + ` FROM assets WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2`
+
+	rows, err := r.db.Query(query, before, limit, storage.TrashDir)
+	if err != nil {
+		return assets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var asset types.Assets
+		if err := rows.Scan(asset.ScanFields()...); err != nil {
+			return assets, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, rows.Err()
+}
+
+// GetAssetsToBackfill returns up to limit assets after the given id that
+// have never had placeholders or metadata computed.
+func (r *Repository) GetAssetsToBackfill(afterID, limit int) ([]types.Assets, error) {
+	var assets []types.Assets
+
+	query := `SELECT ` + types.AssetColumns(3) + ` FROM assets WHERE (blur_hash IS NULL OR width IS NULL) AND id > $1 ORDER BY id LIMIT $2`
+
+	rows, err := r.db.Query(query, afterID, limit, storage.TrashDir)
+	if err != nil {
+		return assets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var asset types.Assets
+		if err := rows.Scan(asset.ScanFields()...); err != nil {
+			return assets, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, rows.Err()
+}
+
+// UpdateAsset changes the editable fields of an asset when it is still at the
+// given revision. Every edit of these fields bumps the revision, so a client
+// editing a stale copy gets 412 instead of overwriting newer changes. A
+// negative revision matches any.
+func (r *Repository) UpdateAsset(filename string, req types.UpdateAssetReq, revision int) (types.Assets, error) {
+	var asset types.Assets
+
+	query := `UPDATE assets SET name = COALESCE($3, name), creator = COALESCE($4, creator), description = COALESCE($5, description),
+		title = COALESCE($6, title), alt_text = COALESCE($7, alt_text)
+		WHERE filename = $1 AND deleted_at IS NULL AND ($2 < 0 OR revision = $2)
+		RETURNING ` + types.AssetColumns(8)
+
+	err := r.db.QueryRow(query, filename, revision, req.Name, req.Creator, req.Description, req.Title, req.AltText, storage.TrashDir).Scan(asset.ScanFields()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Tell a missing asset apart from a stale revision
+		if _, err := r.GetAssetWithFilename(filename); err != nil {
+			return asset, err
+		}
+		return asset, httperrors.NewHttpError("The asset has been modified since it was read.", http.StatusPreconditionFailed)
+	}
+	return asset, err
+}
+
+// AddAssetTags creates the tags that don't exist yet and links them to the
+// asset.
+func (r *Repository) AddAssetTags(filename string, tags []string) (types.Assets, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return types.Assets{}, err
+	}
+	defer tx.Rollback()
+
+	var assetID int
+	err = tx.QueryRow(`SELECT id FROM assets WHERE filename = $1 AND deleted_at IS NULL FOR UPDATE`, filename).Scan(&assetID)
+	if err != nil {
+		return types.Assets{}, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING`, pq.Array(tags))
+	if err != nil {
+		return types.Assets{}, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO asset_tags (asset_id, tag_id) SELECT $1, id FROM tags WHERE name = ANY($2) ON CONFLICT DO NOTHING`, assetID, pq.Array(tags))
+	if err != nil {
+		return types.Assets{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Assets{}, err
+	}
+	return r.GetAssetWithFilename(filename)
+}
+
+// RemoveAssetTags unlinks the tags from the asset. Tags no asset uses
+// anymore are dropped.
+func (r *Repository) RemoveAssetTags(filename string, tags []string) (types.Assets, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return types.Assets{}, err
+	}
+	defer tx.Rollback()
+
+	var assetID int
+	err = tx.QueryRow(`SELECT id FROM assets WHERE filename = $1 AND deleted_at IS NULL FOR UPDATE`, filename).Scan(&assetID)
+	if err != nil {
+		return types.Assets{}, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM asset_tags USING tags WHERE asset_tags.tag_id = tags.id AND asset_tags.asset_id = $1 AND tags.name = ANY($2)`, assetID, pq.Array(tags))
+	if err != nil {
+		return types.Assets{}, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM tags WHERE name = ANY($1) AND NOT EXISTS (SELECT 1 FROM asset_tags WHERE asset_tags.tag_id = tags.id)`, pq.Array(tags))
+	if err != nil {
+		return types.Assets{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Assets{}, err
+	}
+	return r.GetAssetWithFilename(filename)
+}
+
+// GetTags lists every tag with the number of live assets carrying it.
+func (r *Repository) GetTags() ([]types.Tag, error) {
+	tags := []types.Tag{}
+
+	query := `SELECT tags.name, COUNT(assets.id) FROM tags
+		LEFT JOIN asset_tags ON asset_tags.tag_id = tags.id
+		LEFT JOIN assets ON assets.id = asset_tags.asset_id AND assets.deleted_at IS NULL
+		GROUP BY tags.name ORDER BY tags.name`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return tags, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag types.Tag
+		if err := rows.Scan(&tag.Name, &tag.AssetCount); err != nil {
+			return tags, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// UpdateAssetPlaceholders stores the placeholders of an asset. Empty strings
+// mark an asset whose image could not be decoded, so it is not retried.
+func (r *Repository) UpdateAssetPlaceholders(id int, blurHash, thumbHash string) error {
+	_, err := r.db.Exec(`UPDATE assets SET blur_hash = $2, thumb_hash = $3 WHERE id = $1`, id, blurHash, thumbHash)
+	return err
+}
+
+// UpdateAssetMetadata stores the image metadata of an asset. A zero width
+// marks an asset whose image could not be decoded.
+func (r *Repository) UpdateAssetMetadata(id int, meta types.ImageMetadata) error {
+	query := `UPDATE assets SET width = $2, height = $3, orientation = NULLIF($4, 0), camera_make = NULLIF($5, ''), camera_model = NULLIF($6, ''),
+		lens_model = NULLIF($7, ''), taken_at = $8, exposure_time = NULLIF($9, ''), f_number = NULLIF($10::real, 0), iso = NULLIF($11, 0),
+		focal_length = NULLIF($12::real, 0), gps_latitude = $13, gps_longitude = $14, color_space = NULLIF($15, ''), dominant_colors = $16, metadata = $17
+		WHERE id = $1`
+
+	_, err := r.db.Exec(query, id, meta.Width, meta.Height, meta.Orientation, meta.CameraMake, meta.CameraModel, meta.LensModel, meta.TakenAt,
+		meta.ExposureTime, meta.FNumber, meta.ISO, meta.FocalLength, meta.GPSLatitude, meta.GPSLongitude, meta.ColorSpace, pq.Array(meta.DominantColors), meta.EXIF)
+	return err
+}
+
+// AdoptBlob registers the file of an asset uploaded before deduplication as
+// a blob, so it can be versioned like any other content. When the content is
+// already stored under another key the asset shares that blob and the
+// returned key of its own file is no longer used.
+func (r *Repository) AdoptBlob(filename, hash string, size int64, mimeType string) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var storageKey string
+	err = tx.QueryRow(`INSERT INTO blobs (hash, storage_key, size, mime_type, ref_count) VALUES ($1, $2, $3, $4, 1)
+		ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1 RETURNING storage_key`, hash, filename, size, mimeType).Scan(&storageKey)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := tx.Exec(`UPDATE assets SET hash = $2 WHERE filename = $1 AND hash IS NULL`, filename, hash)
+	if err != nil {
+		return "", err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	if storageKey != filename {
+		return filename, tx.Commit()
+	}
+	return "", tx.Commit()
+}
+
+// ReplaceAssetContent makes content the current version of an asset. The
+// content it had is kept as a version with its blob reference. Like
+// CreateAssetRecord it returns a trash key the new file replaced.
+func (r *Repository) ReplaceAssetContent(filename string, content types.CreateAssetReq, replacedBy string) (types.Assets, string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return types.Assets{}, "", err
+	}
+	defer tx.Rollback()
+
+	current, err := lockAsset(tx, filename)
+	if err != nil {
+		return types.Assets{}, "", err
+	}
+
+	if err := archiveVersion(tx, current, replacedBy); err != nil {
+		return types.Assets{}, "", err
+	}
+
+	replacedKey, err := takeBlobRef(tx, content)
+	if err != nil {
+		return types.Assets{}, "", err
+	}
+
+	asset, err := setAssetContent(tx, current.ID, content, current.Version+1)
+	if err != nil {
+		return types.Assets{}, "", err
+	}
+
+	return asset, replacedKey, tx.Commit()
+}
+
+// RevertAsset makes the content of an earlier version current again. The
+// revert is a new version itself, so the history is never rewritten.
+func (r *Repository) RevertAsset(filename string, version int, replacedBy string) (types.Assets, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return types.Assets{}, err
+	}
+	defer tx.Rollback()
+
+	current, err := lockAsset(tx, filename)
+	if err != nil {
+		return types.Assets{}, err
+	}
+
+	var target types.AssetVersion
+	query := `SELECT ` + types.AssetVersionColumns + ` FROM asset_versions WHERE asset_id = $1 AND version = $2`
+	if err := tx.QueryRow(query, current.ID, version).Scan(target.ScanFields()...); err != nil {
+		return types.Assets{}, err
+	}
+
+	if err := archiveVersion(tx, current, replacedBy); err != nil {
+		return types.Assets{}, err
+	}
+
+	// The version keeps its own reference, the asset takes another one
+	if _, err := tx.Exec(`UPDATE blobs SET ref_count = ref_count + 1 WHERE hash = $1`, target.Hash); err != nil {
+		return types.Assets{}, err
+	}
+
+	content := types.CreateAssetReq{
+		MimeType:   target.MimeType,
+		Size:       target.Size,
+		Hash:       target.Hash,
+		BlurHash:   target.BlurHash,
+		ThumbHash:  target.ThumbHash,
+		Metadata:   target.Metadata,
+		Processing: target.Processing,
+		ArchiveKey: target.ArchiveKey,
+	}
+
+	asset, err := setAssetContent(tx, current.ID, content, current.Version+1)
+	if err != nil {
+		return types.Assets{}, err
+	}
+
+	return asset, tx.Commit()
+}
+
+func (r *Repository) GetAssetVersions(assetID int) ([]types.AssetVersion, error) {
+	versions := []types.AssetVersion{}
+
+	query := `SELECT ` + types.AssetVersionColumns + ` FROM asset_versions WHERE asset_id = $1 ORDER BY version DESC`
+
+	rows, err := r.db.Query(query, assetID)
+	if err != nil {
+		return versions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version types.AssetVersion
+		if err := rows.Scan(version.ScanFields()...); err != nil {
+			return versions, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+func (r *Repository) GetAssetVersion(assetID, version int) (types.AssetVersion, error) {
+	var v types.AssetVersion
+
+	query := `SELECT ` + types.AssetVersionColumns + ` FROM asset_versions WHERE asset_id = $1 AND version = $2`
+
+	err := r.db.QueryRow(query, assetID, version).Scan(v.ScanFields()...)
+	return v, err
+}
+
+func lockAsset(tx *sql.Tx, filename string) (types.Assets, error) {
+	var asset types.Assets
+
+	query := `SELECT ` + types.AssetColumns(2) + ` FROM assets WHERE filename = $1 AND deleted_at IS NULL FOR UPDATE`
+
+	err := tx.QueryRow(query, filename, storage.TrashDir).Scan(asset.ScanFields()...)
+	if err == nil && asset.Hash == "" {
+		err = errors.New("asset has no blob, adopt it first")
+	}
+	return asset, err
+}
+
+// archiveVersion keeps the current content of an asset as a version. The
+// asset's blob reference moves to the version row.
+func archiveVersion(tx *sql.Tx, asset types.Assets, replacedBy string) error {
+	query := `INSERT INTO asset_versions (asset_id, version, hash, mime_type, size, blur_hash, thumb_hash, image_metadata, processing, archive_key, replaced_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, $9, NULLIF($10, ''), $11)`
+
+	_, err := tx.Exec(query, asset.ID, asset.Version, asset.Hash, asset.MimeType, asset.Size, asset.BlurHash, asset.ThumbHash,
+		asset.Metadata, asset.Processing, asset.ArchiveKey, replacedBy)
+	return err
+}
+
+// takeBlobRef references the blob of new content, registering it under the
+// content's file when the hash is new. A blob found in the trash is moved to
+// the new file and its trash key is returned.
+func takeBlobRef(tx *sql.Tx, content types.CreateAssetReq) (string, error) {
+	var storageKey string
+	err := tx.QueryRow(`SELECT storage_key FROM blobs WHERE hash = $1 FOR UPDATE`, content.Hash).Scan(&storageKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	replacedKey := ""
+	if strings.HasPrefix(storageKey, trashKey("")) {
+		if _, err := tx.Exec(`UPDATE blobs SET storage_key = $2 WHERE hash = $1`, content.Hash, content.Filename); err != nil {
+			return "", err
+		}
+		replacedKey = storageKey
+	}
+
+	_, err = tx.Exec(`INSERT INTO blobs (hash, storage_key, size, mime_type, ref_count) VALUES ($1, $2, $3, $4, 1)
+		ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1`, content.Hash, content.Filename, content.Size, content.MimeType)
+	return replacedKey, err
+}
+
+func setAssetContent(tx *sql.Tx, id int, content types.CreateAssetReq, version int) (types.Assets, error) {
+	var asset types.Assets
+
+	query := `UPDATE assets SET hash = $2, size = $3, mime_type = $4, blur_hash = NULLIF($5, ''), thumb_hash = NULLIF($6, ''),
+		width = $7, height = $8, orientation = NULLIF($9, 0), camera_make = NULLIF($10, ''), camera_model = NULLIF($11, ''),
+		lens_model = NULLIF($12, ''), taken_at = $13, exposure_time = NULLIF($14, ''), f_number = NULLIF($15::real, 0), iso = NULLIF($16, 0),
+		focal_length = NULLIF($17::real, 0), gps_latitude = $18, gps_longitude = $19, color_space = NULLIF($20, ''), dominant_colors = $21,
+		metadata = $22, processing = $23, archive_key = NULLIF($24, ''), version = $25
+		WHERE id = $1
+		RETURNING ` + types.AssetColumns(26)
+
+	m := content.Metadata
+	err := tx.QueryRow(query, id, content.Hash, content.Size, content.MimeType, content.BlurHash, content.ThumbHash,
+		m.Width, m.Height, m.Orientation, m.CameraMake, m.CameraModel, m.LensModel, m.TakenAt, m.ExposureTime, m.FNumber, m.ISO,
+		m.FocalLength, m.GPSLatitude, m.GPSLongitude, m.ColorSpace, pq.Array(m.DominantColors), m.EXIF, content.Processing, content.ArchiveKey,
+		version, storage.TrashDir).Scan(asset.ScanFields()...)
+	return asset, err
+}
@@ -0,0 +1,99 @@
+package asset
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxSearchTerms is how many words of a search query are used.
+const MaxSearchTerms = 10
+
+var searchTerm = regexp.MustCompile(`[\p{L}\p{M}\p{N}]+`)
+
+// searchFields are the texts a search covers, highlighted in the results.
+// Original filenames are indexed with their separators as spaces.
+var searchFields = []struct {
+	name   string
+	column string
+}{
+	{"name", "name"},
+	{"title", "COALESCE(title, '')"},
+	{"description", "COALESCE(description, '')"},
+	{"alt_text", "COALESCE(alt_text, '')"},
+	{"original_filename", "regexp_replace(COALESCE(original_filename, ''), '[._-]+', ' ', 'g')"},
+	{"tags", "array_to_string(ARRAY(SELECT tags.name FROM asset_tags JOIN tags ON tags.id = asset_tags.tag_id WHERE asset_tags.asset_id = assets.id ORDER BY tags.name), ', ')"},
+}
+
+// SearchAssets finds assets whose name, title, description, alt text,
+// original filename or tags contain every word of 'q', the last letters of a
+// word may be missing. Results are ranked, the listing filters apply and
+// 'offset' pages through them.
+func (h *AssetHandler) SearchAssets(c *gin.Context) {
+	query := searchQuery(c.Query("q"))
+	if query == "" {
+		c.JSON(400, gin.H{"message": "A search query is required. Please use the 'q' parameter."})
+		return
+	}
+
+	filter, err := ParseAssetFilter(c)
+	if err != nil {
+		c.JSON(400, gin.H{"message": "Invalid filter: " + err.Error()})
+		return
+	}
+
+	offset := 0
+	if value := c.Query("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			c.JSON(400, gin.H{"message": "Invalid filter: offset must be a positive number"})
+			return
+		}
+	}
+
+	page, err := h.service.repository.SearchAssets(filter, query, offset)
+	if err != nil {
+		response := httperrors.Handle(err)
+		c.JSON(response.Status, gin.H{"message": "Error searching assets: " + response.Message})
+		return
+	}
+
+	c.JSON(200, page)
+}
+
+// searchQuery turns user input into a tsquery matching assets that contain
+// every word as a prefix. Only letters and digits are kept, so the result is
+// always valid tsquery syntax.
+func searchQuery(input string) string {
+	terms := searchTerm.FindAllString(strings.ToLower(input), MaxSearchTerms)
+
+	for i, term := range terms {
+		terms[i] = "'" + term + "':*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// Matches in headlines are marked with private use characters, so the text
+// can be escaped after ts_headline ran on it.
+const (
+	markStart = "\uE000"
+	markStop  = "\uE001"
+)
+
+// searchHeadline is the SQL for a snippet of a search field with the matches
+// between markStart and markStop. Those characters are removed from the text
+// first, so only ts_headline can place them.
+func searchHeadline(column string, queryParam int) string {
+	return fmt.Sprintf(`ts_headline('simple', translate(%s, '%s%s', ''), to_tsquery('simple', $%d), 'StartSel="%s", StopSel="%s", MaxWords=24, MinWords=8, MaxFragments=2')`,
+		column, markStart, markStop, queryParam, markStart, markStop)
+}
+
+// markHeadline escapes a snippet from searchHeadline for HTML and turns its
+// match markers into <mark> tags, so it can be rendered as is.
+func markHeadline(snippet string) string {
+	return strings.NewReplacer(markStart, "<mark>", markStop, "</mark>").Replace(html.EscapeString(snippet))
+}
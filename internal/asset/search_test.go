@@ -0,0 +1,21 @@
+package asset
+
+import "testing"
+
+func TestMarkHeadline(t *testing.T) {
+	tests := []struct {
+		snippet string
+		want    string
+	}{
+		{"Tom " + markStart + "&" + markStop + " Jerry", "Tom <mark>&amp;</mark> Jerry"},
+		{markStart + "lt" + markStop + " is not <b>", "<mark>lt</mark> is not &lt;b&gt;"},
+		{"AT&T " + markStart + "amp" + markStop, "AT&amp;T <mark>amp</mark>"},
+		{"no matches", "no matches"},
+	}
+
+	for _, tt := range tests {
+		if got := markHeadline(tt.snippet); got != tt.want {
+			t.Errorf("markHeadline(%q) = %q, want %q", tt.snippet, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,50 @@
 package asset
 
+import (
+	memory "github.com/okanay/file-upload-go/cache"
+	"github.com/okanay/file-upload-go/types"
+)
+
 type Service struct {
 	repository *Repository
+	cache      *memory.Cache
+	signingKey string
+}
+
+func NewService(r *Repository, c *memory.Cache, signingKey string) *Service {
+	return &Service{repository: r, cache: c, signingKey: signingKey}
+}
+
+// cachedAsset keeps the fields that are hidden from the JSON API, the memory
+// cache stores values as JSON.
+type cachedAsset struct {
+	Asset      types.Assets `json:"asset"`
+	StorageKey string       `json:"storage_key"`
+}
+
+// GetAsset returns the asset row for a filename, cached for a short time
+// since it is looked up on every delivery request.
+func (s *Service) GetAsset(filename string) (types.Assets, error) {
+	var cached cachedAsset
+
+	if err := s.cache.Get(assetCacheKey(filename), &cached); err == nil {
+		cached.Asset.StorageKey = cached.StorageKey
+		return cached.Asset, nil
+	}
+
+	asset, err := s.repository.GetAssetWithFilename(filename)
+	if err != nil {
+		return asset, err
+	}
+
+	s.cache.Set(assetCacheKey(filename), cachedAsset{Asset: asset, StorageKey: asset.StorageKey})
+	return asset, nil
+}
+
+func (s *Service) InvalidateAsset(filename string) {
+	_ = s.cache.Delete(assetCacheKey(filename))
 }
 
-func NewService(r *Repository) *Service {
-	return &Service{repository: r}
+func assetCacheKey(filename string) string {
+	return "asset:" + filename
 }
@@ -0,0 +1,89 @@
+package asset
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MaxSignedURLExpiry = 7 * 24 * time.Hour
+const DefaultSignedURLExpiry = 1 * time.Hour
+
+// SignURL returns the query string for a presigned asset URL. Every
+// parameter, including transformations like quality and blur, is covered by
+// the signature together with the filename and expiry.
+func (s *Service) SignURL(filename string, params url.Values, expires time.Time) (string, error) {
+	if s.signingKey == "" {
+		return "", errors.New("URL signing is not configured")
+	}
+
+	query := url.Values{}
+	for key, values := range params {
+		if key == "signature" || key == "expires" {
+			continue
+		}
+		query[key] = values
+	}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.signature(filename, query))
+
+	return query.Encode(), nil
+}
+
+// VerifySignature checks the expiry and signature of a presigned request.
+func (s *Service) VerifySignature(filename string, query url.Values) error {
+	if s.signingKey == "" {
+		return errors.New("URL signing is not configured")
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid expires")
+	}
+
+	if time.Now().Unix() > expires {
+		return errors.New("signed URL has expired")
+	}
+
+	expected := s.signature(filename, query)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+func (s *Service) signature(filename string, query url.Values) string {
+	mac := hmac.New(sha256.New, []byte(s.signingKey))
+	mac.Write([]byte(filename + "?" + canonicalQuery(query)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalQuery sorts keys and values so the signature does not depend on
+// the order the client sends the parameters in.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if key != "signature" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
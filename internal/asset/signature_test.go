@@ -0,0 +1,82 @@
+package asset
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	s := &Service{signingKey: "test-key"}
+	future := time.Now().Add(time.Hour)
+
+	signed, err := s.SignURL("a1b2c3d4.jpg", url.Values{"w": {"300"}, "format": {"webp"}}, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := s.SignURL("a1b2c3d4.jpg", url.Values{}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, _ := url.ParseQuery(signed)
+	with := func(key, value string) url.Values {
+		changed := url.Values{}
+		for k, v := range query {
+			changed[k] = append([]string{}, v...)
+		}
+		changed.Set(key, value)
+		return changed
+	}
+
+	reordered, _ := url.ParseQuery("signature=" + query.Get("signature") + "&format=webp&expires=" + query.Get("expires") + "&w=300")
+	expiredQuery, _ := url.ParseQuery(expired)
+
+	tests := []struct {
+		name     string
+		filename string
+		query    url.Values
+		ok       bool
+	}{
+		{"signed", "a1b2c3d4.jpg", query, true},
+		{"parameter order does not matter", "a1b2c3d4.jpg", reordered, true},
+		{"other file", "e5f6a7b8.jpg", query, false},
+		{"changed parameter", "a1b2c3d4.jpg", with("w", "3000"), false},
+		{"added parameter", "a1b2c3d4.jpg", with("h", "300"), false},
+		{"extended expiry", "a1b2c3d4.jpg", with("expires", "99999999999"), false},
+		{"tampered signature", "a1b2c3d4.jpg", with("signature", "00"), false},
+		{"missing expiry", "a1b2c3d4.jpg", url.Values{"signature": query["signature"]}, false},
+		{"expired", "a1b2c3d4.jpg", expiredQuery, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.VerifySignature(tt.filename, tt.query)
+			if (err == nil) != tt.ok {
+				t.Errorf("VerifySignature() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureWithoutKey(t *testing.T) {
+	s := &Service{}
+	if _, err := s.SignURL("a1b2c3d4.jpg", url.Values{}, time.Now().Add(time.Hour)); err == nil {
+		t.Error("signing without a key succeeded")
+	}
+	if err := s.VerifySignature("a1b2c3d4.jpg", url.Values{"expires": {"99999999999"}, "signature": {""}}); err == nil {
+		t.Error("verifying without a key succeeded")
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	a, _ := url.ParseQuery("b=2&a=1&a=0&signature=x")
+	b, _ := url.ParseQuery("a=0&b=2&a=1")
+
+	if got, want := canonicalQuery(a), "a=0&a=1&b=2"; got != want {
+		t.Errorf("canonicalQuery() = %q, want %q", got, want)
+	}
+	if canonicalQuery(a) != canonicalQuery(b) {
+		t.Error("the same parameters in another order canonicalize differently")
+	}
+}
@@ -0,0 +1,63 @@
+package asset
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils"
+	"strings"
+)
+
+// GetTags lists every tag with the number of assets carrying it. Assets of a
+// tag are listed with the 'tag' filter of the asset listing.
+func (h *AssetHandler) GetTags(c *gin.Context) {
+	tags, err := h.service.repository.GetTags()
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Error fetching tags: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"tags": tags})
+}
+
+// TagAsset adds the tags sent under repeated or comma separated 'tags' keys
+// to an asset.
+func (h *AssetHandler) TagAsset(c *gin.Context) {
+	h.changeTags(c, "tagged", h.service.repository.AddAssetTags)
+}
+
+// UntagAsset removes the tags sent like in TagAsset from an asset.
+func (h *AssetHandler) UntagAsset(c *gin.Context) {
+	h.changeTags(c, "untagged", h.service.repository.RemoveAssetTags)
+}
+
+func (h *AssetHandler) changeTags(c *gin.Context, action string, change func(string, []string) (types.Assets, error)) {
+	filename := c.PostForm("filename")
+
+	var tags []string
+	for _, value := range c.PostFormArray("tags") {
+		tags = append(tags, strings.Split(value, ",")...)
+	}
+	tags = utils.NormalizeTags(tags)
+
+	if filename == "" || len(tags) == 0 {
+		c.JSON(400, gin.H{"message": "Filename and tags are required. Please use FormData with 'filename' and 'tags' keys."})
+		return
+	}
+
+	asset, err := change(filename, tags)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"message": "The requested " + filename + " was not found."})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Error updating tags: " + err.Error()})
+		return
+	}
+	h.service.InvalidateAsset(filename)
+
+	fmt.Println("[ASSET "+strings.ToUpper(action)+"]", filename, tags)
+	c.JSON(200, gin.H{"asset": asset})
+}
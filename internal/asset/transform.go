@@ -0,0 +1,265 @@
+package asset
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/storage"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/metadata"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/color"
+	"math"
+	"mime"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const MaxTransformDimension = 4000
+const MaxTransformDPR = 4.0
+const DefaultQuality = 85
+
+var FitModes = []string{"cover", "contain", "fill", "inside"}
+
+var CropGravities = map[string]imaging.Anchor{
+	"center":       imaging.Center,
+	"top":          imaging.Top,
+	"bottom":       imaging.Bottom,
+	"left":         imaging.Left,
+	"right":        imaging.Right,
+	"top-left":     imaging.TopLeft,
+	"top-right":    imaging.TopRight,
+	"bottom-left":  imaging.BottomLeft,
+	"bottom-right": imaging.BottomRight,
+}
+
+// TransformOptions describes a derivative of an original image. Width and
+// Height are already multiplied by the requested device pixel ratio, Format
+// is the output extension or "" to keep the source format.
+type TransformOptions struct {
+	Width   int
+	Height  int
+	Fit     string
+	Crop    string
+	Quality int
+	Format  string
+}
+
+func (o TransformOptions) IsResize() bool {
+	return o.Width > 0 || o.Height > 0
+}
+
+// NeedsTransform reports whether the derivative has to be decoded and
+// re-encoded, either for a resize or a format conversion.
+func (o TransformOptions) NeedsTransform() bool {
+	return o.IsResize() || o.Format != ""
+}
+
+// ParseTransformOptions reads w, h, fit, crop, dpr, quality and format from
+// the request. Without an explicit format the Accept header is negotiated.
+func ParseTransformOptions(c *gin.Context, sourceExt string) (TransformOptions, error) {
+	var opts TransformOptions
+
+	format, err := NegotiateFormat(c.GetHeader("Accept"), c.Query("format"), sourceExt)
+	if err != nil {
+		return opts, err
+	}
+	opts.Format = format
+
+	dpr := 1.0
+	if value := c.Query("dpr"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 1 || parsed > MaxTransformDPR {
+			return opts, fmt.Errorf("dpr must be a number between 1 and %g", MaxTransformDPR)
+		}
+		dpr = parsed
+	}
+
+	for _, param := range []struct {
+		name   string
+		target *int
+	}{{"w", &opts.Width}, {"h", &opts.Height}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return opts, fmt.Errorf("%s must be a positive integer", param.name)
+		}
+
+		scaled := int(math.Round(float64(parsed) * dpr))
+		if scaled > MaxTransformDimension {
+			return opts, fmt.Errorf("%s multiplied by dpr must not exceed %d", param.name, MaxTransformDimension)
+		}
+		*param.target = scaled
+	}
+
+	opts.Fit = strings.ToLower(c.Query("fit"))
+	if opts.Fit != "" && !contains(FitModes, opts.Fit) {
+		return opts, fmt.Errorf("fit must be one of %v", FitModes)
+	}
+
+	opts.Crop = strings.ToLower(c.Query("crop"))
+	if opts.Crop != "" {
+		if _, ok := CropGravities[opts.Crop]; !ok {
+			return opts, fmt.Errorf("crop must be one of center, top, bottom, left, right, top-left, top-right, bottom-left, bottom-right")
+		}
+	}
+
+	if !opts.NeedsTransform() {
+		return opts, nil
+	}
+
+	if value := c.Query("quality"); value != "" {
+		quality, err := strconv.Atoi(value)
+		if err != nil || quality < 1 || quality > 100 {
+			return opts, fmt.Errorf("quality must be between 1 and 100")
+		}
+		opts.Quality = quality
+	}
+
+	if !opts.IsResize() {
+		return opts, nil
+	}
+
+	if ext := outputExt(opts.Format, sourceExt); !CanEncode(ext) {
+		return opts, fmt.Errorf("%s images can't be transformed on this server", strings.TrimPrefix(ext, "."))
+	}
+
+	// Normalize so equivalent requests share one cached derivative
+	switch {
+	case opts.Width == 0 || opts.Height == 0:
+		// A single dimension is a proportional resize for every fit mode
+		if opts.Fit != "inside" {
+			opts.Fit = ""
+		}
+		opts.Crop = ""
+	case opts.Fit == "" || opts.Fit == "cover" || opts.Fit == "contain":
+		if opts.Fit == "" {
+			opts.Fit = "cover"
+		}
+		if opts.Crop == "" {
+			opts.Crop = "center"
+		}
+	default:
+		opts.Crop = ""
+	}
+
+	return opts, nil
+}
+
+func TransformImage(store storage.Storage, optimizedDir string, asset types.Assets, opts TransformOptions) error {
+	ctx := context.Background()
+	filename := asset.Filename
+	outputKey := path.Join(optimizedDir, CreateTransformedFileName(DerivativeName(asset), opts))
+
+	if storage.Exists(ctx, store, outputKey) {
+		return nil
+	}
+
+	reader, _, err := store.Get(ctx, asset.StorageKey)
+	if err != nil {
+		return fmt.Errorf("input file does not exist: %s", filename)
+	}
+	defer reader.Close()
+
+	srcImage, err := metadata.Decode(reader, imaging.AutoOrientation(true))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if opts.Format != "" {
+		ext = opts.Format
+	}
+	dstImage := applyTransform(srcImage, opts, ext)
+
+	data, err := processor.Encode(dstImage, ext, opts.Quality)
+	if err != nil {
+		return err
+	}
+
+	err = store.Put(ctx, outputKey, bytes.NewReader(data), int64(len(data)), mime.TypeByExtension(ext))
+	if err != nil {
+		return fmt.Errorf("failed to store transformed image: %v", err)
+	}
+
+	fmt.Println("[TRANSFORM IMAGE] ", outputKey)
+	return nil
+}
+
+func applyTransform(img image.Image, opts TransformOptions, ext string) image.Image {
+	width, height := opts.Width, opts.Height
+
+	// A format conversion keeps the dimensions
+	if !opts.IsResize() {
+		return img
+	}
+
+	// With a single dimension every fit mode is a proportional resize
+	if width == 0 || height == 0 {
+		if opts.Fit == "inside" {
+			bounds := img.Bounds()
+			if (width > 0 && width >= bounds.Dx()) || (height > 0 && height >= bounds.Dy()) {
+				return img
+			}
+		}
+		return imaging.Resize(img, width, height, imaging.Lanczos)
+	}
+
+	anchor := CropGravities[opts.Crop]
+
+	switch opts.Fit {
+	case "fill":
+		return imaging.Resize(img, width, height, imaging.Lanczos)
+	case "inside":
+		return imaging.Fit(img, width, height, imaging.Lanczos)
+	case "contain":
+		var fitted *image.NRGBA
+		bounds := img.Bounds()
+		if float64(bounds.Dx())/float64(bounds.Dy()) > float64(width)/float64(height) {
+			fitted = imaging.Resize(img, width, 0, imaging.Lanczos)
+		} else {
+			fitted = imaging.Resize(img, 0, height, imaging.Lanczos)
+		}
+
+		// JPEG has no alpha channel, letterbox it with white instead
+		background := color.Color(color.Transparent)
+		if ext == ".jpg" || ext == ".jpeg" {
+			background = color.White
+		}
+
+		canvas := imaging.New(width, height, background)
+		return imaging.Paste(canvas, fitted, anchorPoint(canvas.Bounds(), fitted.Bounds(), anchor))
+	default:
+		return imaging.Fill(img, width, height, anchor, imaging.Lanczos)
+	}
+}
+
+func anchorPoint(canvas, img image.Rectangle, anchor imaging.Anchor) image.Point {
+	x := (canvas.Dx() - img.Dx()) / 2
+	y := (canvas.Dy() - img.Dy()) / 2
+
+	switch anchor {
+	case imaging.TopLeft, imaging.Left, imaging.BottomLeft:
+		x = 0
+	case imaging.TopRight, imaging.Right, imaging.BottomRight:
+		x = canvas.Dx() - img.Dx()
+	}
+
+	switch anchor {
+	case imaging.TopLeft, imaging.Top, imaging.TopRight:
+		y = 0
+	case imaging.BottomLeft, imaging.Bottom, imaging.BottomRight:
+		y = canvas.Dy() - img.Dy()
+	}
+
+	return image.Pt(x, y)
+}
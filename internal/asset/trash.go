@@ -0,0 +1,154 @@
+package asset
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/storage"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"time"
+)
+
+// TrashRetention is how long trashed assets can be restored before the
+// purger removes them for good.
+var TrashRetention = 30 * 24 * time.Hour
+
+const TrashPurgeInterval = time.Hour
+const trashPurgeBatch = 100
+
+// GetTrash lists trashed assets with the same filters and paging as the
+// asset listing.
+func (h *AssetHandler) GetTrash(c *gin.Context) {
+	filter, err := ParseAssetFilter(c)
+	if err != nil {
+		c.JSON(400, gin.H{"message": "Invalid filter: " + err.Error()})
+		return
+	}
+	filter.Trashed = true
+
+	page, err := h.service.repository.GetAllAssets(filter)
+	if err != nil {
+		response := httperrors.Handle(err)
+		c.JSON(response.Status, gin.H{"message": "Error fetching trash: " + response.Message})
+		return
+	}
+
+	c.JSON(200, page)
+}
+
+func (h *AssetHandler) RestoreAsset(c *gin.Context) {
+	filename := c.PostForm("filename")
+	if filename == "" {
+		c.JSON(400, gin.H{"message": "Filename is required. Please use FormData with 'filename' key."})
+		return
+	}
+
+	err := h.service.repository.RestoreAsset(filename, h.moveFunc(c.Request.Context()))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"message": "The requested " + filename + " is not in the trash."})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Error restoring asset: " + err.Error()})
+		return
+	}
+	h.service.InvalidateAsset(filename)
+
+	asset, err := h.service.GetAsset(filename)
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Error fetching asset: " + err.Error()})
+		return
+	}
+
+	fmt.Println("[ASSET RESTORED] Asset has been restored:", filename)
+	c.JSON(200, gin.H{"asset": asset})
+}
+
+// moveFunc moves files in the asset storage for the repository.
+func (h *AssetHandler) moveFunc(ctx context.Context) MoveFunc {
+	return func(from, to string) error {
+		return storage.Move(ctx, h.Storage, from, to)
+	}
+}
+
+// PurgeAsset deletes a trashed asset for good, without waiting for the
+// retention window.
+func (h *AssetHandler) PurgeAsset(c *gin.Context) {
+	filename := c.PostForm("filename")
+	if filename == "" {
+		c.JSON(400, gin.H{"message": "Filename is required. Please use FormData with 'filename' key."})
+		return
+	}
+
+	asset, err := h.service.repository.GetTrashedAsset(filename)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"message": "The requested " + filename + " is not in the trash."})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Error purging asset: " + err.Error()})
+		return
+	}
+
+	if err := h.purgeAsset(c.Request.Context(), asset); err != nil {
+		c.JSON(500, gin.H{"message": "Error purging asset: " + err.Error()})
+		return
+	}
+
+	fmt.Println("[ASSET PURGED] Asset has been purged:", filename)
+	c.JSON(200, gin.H{"message": "Asset has been deleted permanently."})
+}
+
+// purgeAsset removes the row of a trashed asset and its versions, the files
+// no other asset uses any more and the archived originals.
+func (h *AssetHandler) purgeAsset(ctx context.Context, asset types.Assets) error {
+	keys, err := h.service.repository.PurgeAsset(asset.Filename)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := h.Storage.Delete(ctx, key); err != nil {
+			fmt.Println("[ASSET PURGED] Error deleting file:", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (h *AssetHandler) purgeRoutine() {
+	ticker := time.NewTicker(TrashPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.purgeExpiredTrash()
+	}
+}
+
+func (h *AssetHandler) purgeExpiredTrash() {
+	before := time.Now().Add(-TrashRetention)
+
+	for {
+		assets, err := h.service.repository.GetExpiredTrash(before, trashPurgeBatch)
+		if err != nil {
+			fmt.Println("[TRASH PURGER] Error fetching expired trash:", err)
+			return
+		}
+
+		for _, asset := range assets {
+			if err := h.purgeAsset(context.Background(), asset); err != nil {
+				// Stop rather than fetch the same failing batch again
+				fmt.Println("[TRASH PURGER] Error purging asset", asset.Filename, err)
+				return
+			}
+			fmt.Println("[TRASH PURGER] Expired asset has been purged:", asset.Filename)
+		}
+
+		if len(assets) < trashPurgeBatch {
+			return
+		}
+	}
+}
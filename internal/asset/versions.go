@@ -0,0 +1,190 @@
+package asset
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/db"
+	"github.com/okanay/file-upload-go/internal/upload"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+// ReplaceAsset uploads new content for an existing asset. The filename and
+// every URL pointing at it stay the same; the previous content is kept as a
+// version and its derivatives are dropped.
+func (h *AssetHandler) ReplaceAsset(c *gin.Context) {
+	filename := c.PostForm("filename")
+	if filename == "" {
+		c.JSON(400, gin.H{"message": "Filename is required. Please use FormData with 'filename' key."})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"message": "File is required. Please use FormData with 'file' key."})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > upload.MAX_UPLOAD_SIZE {
+		c.JSON(413, gin.H{"message": "Max upload size exceeded."})
+		return
+	}
+
+	asset, err := h.service.repository.GetAssetWithFilename(filename)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"message": "The requested " + filename + " was not found."})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Error fetching asset: " + err.Error()})
+		return
+	}
+
+	// The filename keeps its extension, so the content has to keep its type
+	if upload.ALLOWED_MIME_TYPES[filepath.Ext(header.Filename)] != asset.MimeType {
+		c.JSON(400, gin.H{"message": "The new content must be a " + asset.MimeType + " file."})
+		return
+	}
+
+	if asset.Hash == "" {
+		if err := h.adoptBlob(c.Request.Context(), asset); err != nil {
+			c.JSON(500, gin.H{"message": "Error preparing asset: " + err.Error()})
+			return
+		}
+	}
+
+	user := db.CurrentUser(c).Username
+	content, err := h.uploads.StoreContent(file, header, types.UploadOptions{Creator: user, Ingest: c.PostForm("ingest")})
+	if err != nil {
+		response := httperrors.Handle(err)
+		c.JSON(response.Status, gin.H{"message": response.Message})
+		return
+	}
+
+	updated, replacedKey, err := h.service.repository.ReplaceAssetContent(asset.Filename, content, user)
+	if err != nil {
+		h.uploads.DiscardContent(content)
+		c.JSON(500, gin.H{"message": "Error replacing asset: " + err.Error()})
+		return
+	}
+	h.uploads.SettleContent(content, updated.StorageKey, replacedKey)
+	h.invalidateContent(asset.Filename)
+
+	fmt.Println("[ASSET REPLACED] Asset content has been replaced:", asset.Filename, "version", updated.Version)
+	c.JSON(200, gin.H{"asset": updated})
+}
+
+// GetAssetVersions lists the earlier versions of an asset, newest first.
+func (h *AssetHandler) GetAssetVersions(c *gin.Context) {
+	filename := c.Query("filename")
+
+	asset, err := h.service.repository.GetAssetWithFilename(filename)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"message": "The requested " + filename + " was not found."})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Error fetching asset: " + err.Error()})
+		return
+	}
+
+	versions, err := h.service.repository.GetAssetVersions(asset.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Error fetching versions: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"asset": asset, "versions": versions})
+}
+
+// RevertAsset makes an earlier version the current content again.
+func (h *AssetHandler) RevertAsset(c *gin.Context) {
+	filename := c.PostForm("filename")
+	version, err := strconv.Atoi(c.PostForm("version"))
+	if filename == "" || err != nil {
+		c.JSON(400, gin.H{"message": "Filename and version are required. Please use FormData with 'filename' and 'version' keys."})
+		return
+	}
+
+	updated, err := h.service.repository.RevertAsset(filename, version, db.CurrentUser(c).Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"message": fmt.Sprintf("Version %d of %s was not found.", version, filename)})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": "Error reverting asset: " + err.Error()})
+		return
+	}
+	h.invalidateContent(filename)
+
+	fmt.Println("[ASSET REVERTED] Asset has been reverted:", filename, "to version", version)
+	c.JSON(200, gin.H{"asset": updated})
+}
+
+// versionAsset returns the asset as it was at an earlier version, for
+// delivery of that version's original.
+func (h *AssetHandler) versionAsset(asset types.Assets, value string) (types.Assets, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return asset, httperrors.NewHttpError("Invalid version.", 400)
+	}
+	if number == asset.Version {
+		return asset, nil
+	}
+
+	version, err := h.service.repository.GetAssetVersion(asset.ID, number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return asset, httperrors.NewHttpError(fmt.Sprintf("Version %d of %s was not found.", number, asset.Filename), 404)
+	}
+	if err != nil {
+		return asset, err
+	}
+
+	asset.Version = version.Version
+	asset.Hash = version.Hash
+	asset.MimeType = version.MimeType
+	asset.Size = version.Size
+	asset.StorageKey = version.StorageKey
+	asset.UpdatedAt = version.CreatedAt
+	return asset, nil
+}
+
+// adoptBlob hashes the file of an asset uploaded before deduplication and
+// registers it as a blob, which versioning needs.
+func (h *AssetHandler) adoptBlob(ctx context.Context, asset types.Assets) error {
+	reader, info, err := h.Storage.Get(ctx, asset.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return err
+	}
+
+	unusedKey, err := h.service.repository.AdoptBlob(asset.Filename, hex.EncodeToString(hasher.Sum(nil)), info.Size, asset.MimeType)
+	if err != nil {
+		return err
+	}
+	if unusedKey != "" {
+		_ = h.Storage.Delete(ctx, unusedKey)
+	}
+	return nil
+}
+
+// invalidateContent drops everything derived from the content of an asset
+// after it changed.
+func (h *AssetHandler) invalidateContent(filename string) {
+	h.service.InvalidateAsset(filename)
+	h.derivatives.Purge(h.BlurDir, h.OptimizedDir, filename)
+}
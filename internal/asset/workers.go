@@ -0,0 +1,60 @@
+package asset
+
+import (
+	"errors"
+	"runtime"
+	"time"
+)
+
+// ImageWorkers and ImageQueueDepth bound the image processing done for
+// derivatives: at most ImageWorkers jobs run at once and at most
+// ImageQueueDepth more wait for a worker.
+var ImageWorkers = runtime.NumCPU()
+var ImageQueueDepth = 64
+
+const QueueTimeout = 30 * time.Second
+const RetryAfterSeconds = 5
+
+var ErrPoolSaturated = errors.New("image processing is saturated, try again later")
+
+type WorkerPool struct {
+	slots   chan struct{}
+	pending chan struct{}
+}
+
+func NewWorkerPool(workers, queueDepth int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+
+	return &WorkerPool{
+		slots:   make(chan struct{}, workers),
+		pending: make(chan struct{}, workers+queueDepth),
+	}
+}
+
+// Do runs job on a worker. It fails fast with ErrPoolSaturated when the
+// queue is full, or when no worker frees up within QueueTimeout.
+func (p *WorkerPool) Do(job func() error) error {
+	select {
+	case p.pending <- struct{}{}:
+	default:
+		return ErrPoolSaturated
+	}
+	defer func() { <-p.pending }()
+
+	timer := time.NewTimer(QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-timer.C:
+		return ErrPoolSaturated
+	}
+	defer func() { <-p.slots }()
+
+	return job()
+}
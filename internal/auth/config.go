@@ -0,0 +1,8 @@
+package auth
+
+import "time"
+
+const SESSION_COOKIE = "session_token"
+
+var SESSION_DURATION = 24 * time.Hour
+var SESSION_CLEANUP_INTERVAL = 1 * time.Hour
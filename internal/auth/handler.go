@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/db"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"net/http"
+	"strconv"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{
+		service: s,
+	}
+}
+
+func (h *Handler) Login(c *gin.Context) {
+	var req types.LoginReq
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required."})
+		return
+	}
+
+	token, session, err := h.service.Login(req, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(SESSION_COOKIE, token, int(SESSION_DURATION.Seconds()), "/", "", true, true)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login Successful", "expires_at": session.ExpiresAt})
+}
+
+func (h *Handler) Logout(c *gin.Context) {
+	if token, err := c.Cookie(SESSION_COOKIE); err == nil && token != "" {
+		if err := h.service.Logout(token); err != nil {
+			h.handleError(c, err)
+			return
+		}
+	}
+
+	c.SetCookie(SESSION_COOKIE, "", -1, "/", "", true, true)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logout Successful"})
+}
+
+func (h *Handler) Me(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"user": db.CurrentUser(c)})
+}
+
+func (h *Handler) GetSessions(c *gin.Context) {
+	sessions, err := h.service.GetSessions(db.CurrentUser(c).ID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *Handler) RevokeSession(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session id."})
+		return
+	}
+
+	err = h.service.RevokeSession(db.CurrentUser(c).ID, sessionID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session has been revoked."})
+}
+
+func (h *Handler) handleError(c *gin.Context, err error) {
+	response := httperrors.Handle(err)
+	c.JSON(response.Status, gin.H{"error": response.Message})
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"database/sql"
+	"github.com/okanay/file-upload-go/types"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+type IRepository interface {
+	CreateUser(username, passwordHash string) (types.User, error)
+	GetUserWithPassword(username string) (types.User, string, error)
+	CreateSession(req types.CreateSessionReq) (types.Session, error)
+	GetSessionUser(tokenHash string) (types.User, types.Session, error)
+	GetUserSessions(userID int) ([]types.Session, error)
+	RevokeSession(userID, sessionID int) (bool, error)
+	RevokeSessionWithToken(tokenHash string) error
+	DeleteExpiredSessions() (int64, error)
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateUser(username, passwordHash string) (types.User, error) {
+	var user types.User
+
+	query := `INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING id, username, created_at, updated_at`
+
+	err := r.db.QueryRow(query, username, passwordHash).Scan(&user.ID, &user.Username, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+func (r *Repository) GetUserWithPassword(username string) (types.User, string, error) {
+	var user types.User
+	var passwordHash string
+
+	query := `SELECT id, username, created_at, updated_at, password_hash FROM users WHERE username = $1`
+
+	err := r.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.CreatedAt, &user.UpdatedAt, &passwordHash)
+	if err != nil {
+		return user, "", err
+	}
+
+	return user, passwordHash, nil
+}
+
+func (r *Repository) CreateSession(req types.CreateSessionReq) (types.Session, error) {
+	var session types.Session
+
+	query := `INSERT INTO sessions (user_id, token_hash, user_agent, ip_address, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id, user_id, user_agent, ip_address, expires_at, revoked_at, created_at`
+
+	err := r.db.QueryRow(query, req.UserID, req.TokenHash, req.UserAgent, req.IPAddress, req.ExpiresAt).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.ExpiresAt, &session.RevokedAt, &session.CreatedAt)
+	if err != nil {
+		return session, err
+	}
+
+	return session, nil
+}
+
+// GetSessionUser returns the owner of an active session, revoked and expired
+// sessions are not found.
+func (r *Repository) GetSessionUser(tokenHash string) (types.User, types.Session, error) {
+	var user types.User
+	var session types.Session
+
+	query := `SELECT u.id, u.username, u.created_at, u.updated_at, s.id, s.user_id, s.user_agent, s.ip_address, s.expires_at, s.revoked_at, s.created_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.revoked_at IS NULL AND s.expires_at > NOW()`
+
+	err := r.db.QueryRow(query, tokenHash).Scan(&user.ID, &user.Username, &user.CreatedAt, &user.UpdatedAt, &session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.ExpiresAt, &session.RevokedAt, &session.CreatedAt)
+	if err != nil {
+		return user, session, err
+	}
+
+	return user, session, nil
+}
+
+func (r *Repository) GetUserSessions(userID int) ([]types.Session, error) {
+	sessions := []types.Session{}
+
+	query := `SELECT id, user_id, user_agent, ip_address, expires_at, revoked_at, created_at FROM sessions WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW() ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session types.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.ExpiresAt, &session.RevokedAt, &session.CreatedAt); err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (r *Repository) RevokeSession(userID, sessionID int) (bool, error) {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	result, err := r.db.Exec(query, sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *Repository) RevokeSessionWithToken(tokenHash string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL`
+
+	_, err := r.db.Exec(query, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) DeleteExpiredSessions() (int64, error) {
+	query := `DELETE FROM sessions WHERE expires_at < NOW() OR revoked_at < NOW() - INTERVAL '1 day'`
+
+	result, err := r.db.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
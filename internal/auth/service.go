@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"time"
+)
+
+// dummyHash is compared against when the user does not exist, so unknown
+// usernames take as long as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+type Service struct {
+	repository *Repository
+}
+
+func NewService(r *Repository) *Service {
+	service := &Service{repository: r}
+
+	go service.cleanupRoutine()
+	return service
+}
+
+// EnsureUser creates the user when it does not exist yet. It is used to seed
+// the first account from the environment.
+func (s *Service) EnsureUser(username, password string) error {
+	_, _, err := s.repository.GetUserWithPassword(username)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = s.CreateUser(username, password)
+	return err
+}
+
+func (s *Service) CreateUser(username, password string) (types.User, error) {
+	if username == "" || len(password) < 8 {
+		return types.User{}, httperrors.NewHttpError("Username is required and password must be at least 8 characters.", http.StatusBadRequest)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return types.User{}, err
+	}
+
+	user, err := s.repository.CreateUser(username, string(hash))
+	if err != nil {
+		return user, err
+	}
+
+	fmt.Println("[AUTH] User created:", user.Username)
+	return user, nil
+}
+
+// Login checks the credentials and opens a new session. The returned token
+// is only known to the client, the database keeps its hash.
+func (s *Service) Login(req types.LoginReq, userAgent, ipAddress string) (string, types.Session, error) {
+	invalid := httperrors.NewHttpError("Invalid username or password.", http.StatusUnauthorized)
+
+	user, passwordHash, err := s.repository.GetUserWithPassword(req.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(req.Password))
+		return "", types.Session{}, invalid
+	}
+	if err != nil {
+		return "", types.Session{}, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)) != nil {
+		return "", types.Session{}, invalid
+	}
+
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", types.Session{}, err
+	}
+
+	session, err := s.repository.CreateSession(types.CreateSessionReq{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		ExpiresAt: time.Now().Add(SESSION_DURATION),
+	})
+	if err != nil {
+		return "", session, err
+	}
+
+	fmt.Println("[AUTH] Session created for:", user.Username)
+	return token, session, nil
+}
+
+func (s *Service) ValidateSession(token string) (types.User, error) {
+	user, _, err := s.repository.GetSessionUser(utils.HashToken(token))
+	return user, err
+}
+
+func (s *Service) Logout(token string) error {
+	return s.repository.RevokeSessionWithToken(utils.HashToken(token))
+}
+
+func (s *Service) GetSessions(userID int) ([]types.Session, error) {
+	return s.repository.GetUserSessions(userID)
+}
+
+func (s *Service) RevokeSession(userID, sessionID int) error {
+	revoked, err := s.repository.RevokeSession(userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return httperrors.NewHttpError("Session not found.", http.StatusNotFound)
+	}
+
+	return nil
+}
+
+func (s *Service) cleanupRoutine() {
+	ticker := time.NewTicker(SESSION_CLEANUP_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.repository.DeleteExpiredSessions()
+		if err != nil {
+			fmt.Println("[AUTH] Error cleaning sessions:", err)
+			continue
+		}
+		fmt.Println("[AUTH] Expired sessions have been cleaned:", deleted)
+	}
+}
@@ -0,0 +1,125 @@
+package collection
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/db"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"net/http"
+	"strconv"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{
+		service: s,
+	}
+}
+
+func (h *Handler) CreateCollection(c *gin.Context) {
+	var req types.CreateCollectionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required."})
+		return
+	}
+
+	collection, err := h.service.CreateCollection(db.CurrentUser(c).Username, req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"collection": collection})
+}
+
+// GetCollections lists the collections. Assets of a collection are listed
+// with the 'collection' filter of the asset listing.
+func (h *Handler) GetCollections(c *gin.Context) {
+	collections, err := h.service.GetCollections()
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collections": collections})
+}
+
+func (h *Handler) UpdateCollection(c *gin.Context) {
+	id, ok := collectionID(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateCollectionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required."})
+		return
+	}
+
+	collection, err := h.service.UpdateCollection(id, req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collection": collection})
+}
+
+func (h *Handler) AddAssets(c *gin.Context) {
+	id, ok := collectionID(c)
+	if !ok {
+		return
+	}
+
+	var req types.CollectionAssetsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filenames are required."})
+		return
+	}
+
+	collection, missing, err := h.service.AddAssets(id, req.Filenames)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collection": collection, "not_found": missing})
+}
+
+func (h *Handler) RemoveAssets(c *gin.Context) {
+	id, ok := collectionID(c)
+	if !ok {
+		return
+	}
+
+	var req types.CollectionAssetsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filenames are required."})
+		return
+	}
+
+	collection, err := h.service.RemoveAssets(id, req.Filenames)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collection": collection})
+}
+
+func collectionID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection id."})
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) handleError(c *gin.Context, err error) {
+	response := httperrors.Handle(err)
+	c.JSON(response.Status, gin.H{"error": response.Message})
+}
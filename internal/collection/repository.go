@@ -0,0 +1,111 @@
+package collection
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/okanay/file-upload-go/types"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+type IRepository interface {
+	CreateCollection(creator string, req types.CreateCollectionReq) (types.Collection, error)
+	UpdateCollection(id int, req types.UpdateCollectionReq) (types.Collection, error)
+	GetCollections() ([]types.Collection, error)
+	GetCollection(id int) (types.Collection, error)
+	AddAssets(id int, filenames []string) ([]string, error)
+	RemoveAssets(id int, filenames []string) (int64, error)
+}
+
+// collectionColumns is the select list scanned by scanCollection. Trashed
+// assets stay in their collections but are not counted.
+const collectionColumns = `id, name, COALESCE(description, ''), creator,
+	(SELECT COUNT(*) FROM collection_assets JOIN assets ON assets.id = collection_assets.asset_id
+		WHERE collection_assets.collection_id = collections.id AND assets.deleted_at IS NULL),
+	created_at, updated_at`
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateCollection(creator string, req types.CreateCollectionReq) (types.Collection, error) {
+	query := `INSERT INTO collections (name, description, creator) VALUES ($1, NULLIF($2, ''), $3) RETURNING ` + collectionColumns
+	return scanCollection(r.db.QueryRow(query, req.Name, req.Description, creator))
+}
+
+// UpdateCollection renames a collection, the description is only changed
+// when it is set.
+func (r *Repository) UpdateCollection(id int, req types.UpdateCollectionReq) (types.Collection, error) {
+	query := `UPDATE collections SET name = $2, description = CASE WHEN $3::text IS NULL THEN description ELSE NULLIF($3, '') END
+		WHERE id = $1 RETURNING ` + collectionColumns
+	return scanCollection(r.db.QueryRow(query, id, req.Name, req.Description))
+}
+
+func (r *Repository) GetCollections() ([]types.Collection, error) {
+	collections := []types.Collection{}
+
+	rows, err := r.db.Query(`SELECT ` + collectionColumns + ` FROM collections ORDER BY name`)
+	if err != nil {
+		return collections, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return collections, err
+		}
+		collections = append(collections, collection)
+	}
+
+	return collections, rows.Err()
+}
+
+func (r *Repository) GetCollection(id int) (types.Collection, error) {
+	return scanCollection(r.db.QueryRow(`SELECT `+collectionColumns+` FROM collections WHERE id = $1`, id))
+}
+
+// AddAssets adds live assets to a collection and returns the filenames that
+// matched no live asset. Assets already in the collection are left as they
+// are.
+func (r *Repository) AddAssets(id int, filenames []string) ([]string, error) {
+	query := `WITH found AS (SELECT id, filename FROM assets WHERE filename = ANY($2) AND deleted_at IS NULL),
+		added AS (INSERT INTO collection_assets (collection_id, asset_id) SELECT $1, id FROM found ON CONFLICT DO NOTHING)
+		SELECT filename FROM unnest($2::text[]) AS filename WHERE filename NOT IN (SELECT filename FROM found)`
+
+	rows, err := r.db.Query(query, id, pq.Array(filenames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	missing := []string{}
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			return missing, err
+		}
+		missing = append(missing, filename)
+	}
+
+	return missing, rows.Err()
+}
+
+// RemoveAssets takes assets out of a collection and returns how many were
+// in it.
+func (r *Repository) RemoveAssets(id int, filenames []string) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM collection_assets USING assets
+		WHERE collection_assets.asset_id = assets.id AND collection_assets.collection_id = $1 AND assets.filename = ANY($2)`, id, pq.Array(filenames))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanCollection(row interface{ Scan(...interface{}) error }) (types.Collection, error) {
+	var c types.Collection
+	err := row.Scan(&c.ID, &c.Name, &c.Description, &c.Creator, &c.AssetCount, &c.CreatedAt, &c.UpdatedAt)
+	return c, err
+}
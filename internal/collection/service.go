@@ -0,0 +1,110 @@
+package collection
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"net/http"
+	"strings"
+)
+
+// MAX_COLLECTION_ASSETS is how many assets one request can add or remove.
+const MAX_COLLECTION_ASSETS = 1000
+
+type Service struct {
+	repository *Repository
+}
+
+func NewService(r *Repository) *Service {
+	return &Service{repository: r}
+}
+
+func (s *Service) CreateCollection(creator string, req types.CreateCollectionReq) (types.Collection, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return types.Collection{}, httperrors.NewHttpError("Name is required.", http.StatusBadRequest)
+	}
+
+	collection, err := s.repository.CreateCollection(creator, req)
+	if err != nil {
+		return collection, err
+	}
+
+	fmt.Println("[COLLECTION] Collection created:", collection.ID, collection.Name)
+	return collection, nil
+}
+
+func (s *Service) UpdateCollection(id int, req types.UpdateCollectionReq) (types.Collection, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return types.Collection{}, httperrors.NewHttpError("Name is required.", http.StatusBadRequest)
+	}
+
+	collection, err := s.repository.UpdateCollection(id, req)
+	if err != nil {
+		return collection, notFound(err)
+	}
+
+	fmt.Println("[COLLECTION] Collection updated:", collection.ID, collection.Name)
+	return collection, nil
+}
+
+func (s *Service) GetCollections() ([]types.Collection, error) {
+	return s.repository.GetCollections()
+}
+
+// AddAssets adds assets to a collection. The returned filenames matched no
+// asset and were skipped.
+func (s *Service) AddAssets(id int, filenames []string) (types.Collection, []string, error) {
+	if err := checkFilenames(filenames); err != nil {
+		return types.Collection{}, nil, err
+	}
+
+	if _, err := s.repository.GetCollection(id); err != nil {
+		return types.Collection{}, nil, notFound(err)
+	}
+
+	missing, err := s.repository.AddAssets(id, filenames)
+	if err != nil {
+		return types.Collection{}, nil, notFound(err)
+	}
+
+	collection, err := s.repository.GetCollection(id)
+	return collection, missing, notFound(err)
+}
+
+func (s *Service) RemoveAssets(id int, filenames []string) (types.Collection, error) {
+	if err := checkFilenames(filenames); err != nil {
+		return types.Collection{}, err
+	}
+
+	if _, err := s.repository.GetCollection(id); err != nil {
+		return types.Collection{}, notFound(err)
+	}
+
+	if _, err := s.repository.RemoveAssets(id, filenames); err != nil {
+		return types.Collection{}, err
+	}
+
+	collection, err := s.repository.GetCollection(id)
+	return collection, notFound(err)
+}
+
+func checkFilenames(filenames []string) error {
+	if len(filenames) == 0 {
+		return httperrors.NewHttpError("At least one filename is required.", http.StatusBadRequest)
+	}
+	if len(filenames) > MAX_COLLECTION_ASSETS {
+		return httperrors.NewHttpError(fmt.Sprintf("At most %d assets can be changed at once.", MAX_COLLECTION_ASSETS), http.StatusBadRequest)
+	}
+	return nil
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return httperrors.NewHttpError("Collection not found.", http.StatusNotFound)
+	}
+	return err
+}
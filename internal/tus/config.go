@@ -0,0 +1,12 @@
+package tus
+
+import "time"
+
+const TUS_VERSION = "1.0.0"
+const TUS_EXTENSIONS = "creation,termination,expiration"
+
+// TUS_MAX_SIZE caps resumable uploads, upload.MAX_UPLOAD_SIZE applies too.
+var TUS_MAX_SIZE int64 = 512 * 1024 * 1024
+var TUS_UPLOAD_DIR = "./tmp/tus"
+var TUS_EXPIRATION = 24 * time.Hour
+var TUS_CLEANUP_INTERVAL = 15 * time.Minute
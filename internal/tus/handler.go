@@ -0,0 +1,133 @@
+package tus
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/db"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"net/http"
+	"strconv"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{
+		service: s,
+	}
+}
+
+func (h *Handler) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", TUS_VERSION)
+	c.Header("Tus-Version", TUS_VERSION)
+	c.Header("Tus-Max-Size", strconv.FormatInt(MaxSize(), 10))
+	c.Header("Tus-Extension", TUS_EXTENSIONS)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) CreateUpload(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length header is required."})
+		return
+	}
+
+	upload, err := h.service.CreateUpload(db.CurrentUser(c).Username, length, c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Header("Location", "/auth/files/"+upload.ID)
+	h.setUploadHeaders(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+func (h *Handler) GetUploadStatus(c *gin.Context) {
+	c.Header("Tus-Resumable", TUS_VERSION)
+	c.Header("Cache-Control", "no-store")
+
+	upload, err := h.service.GetUpload(c.Param("id"), db.CurrentUser(c).Username)
+	if err != nil {
+		c.Status(httperrors.Handle(err).Status)
+		return
+	}
+
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	h.setUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+func (h *Handler) PatchUpload(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/offset+octet-stream."})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header is required."})
+		return
+	}
+
+	upload, err := h.service.WriteChunk(c.Param("id"), db.CurrentUser(c).Username, offset, c.Request.Body)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	h.setUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) TerminateUpload(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	err := h.service.TerminateUpload(c.Param("id"), db.CurrentUser(c).Username)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) checkVersion(c *gin.Context) bool {
+	c.Header("Tus-Resumable", TUS_VERSION)
+
+	if c.GetHeader("Tus-Resumable") != TUS_VERSION {
+		c.Header("Tus-Version", TUS_VERSION)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Unsupported Tus-Resumable version. Supported: " + TUS_VERSION})
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) setUploadHeaders(c *gin.Context, upload types.TusUpload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.AssetFilename != "" {
+		c.Header("Asset-Filename", upload.AssetFilename)
+	}
+}
+
+func (h *Handler) handleError(c *gin.Context, err error) {
+	response := httperrors.Handle(err)
+	c.JSON(response.Status, gin.H{"error": response.Message})
+}
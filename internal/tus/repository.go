@@ -0,0 +1,104 @@
+package tus
+
+import (
+	"database/sql"
+	"github.com/okanay/file-upload-go/types"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+type IRepository interface {
+	CreateUpload(req types.CreateTusUploadReq) (types.TusUpload, error)
+	GetUpload(id string) (types.TusUpload, error)
+	UpdateOffset(id string, offset int64) error
+	CompleteUpload(id string, assetFilename string) error
+	DeleteUpload(id string) error
+	GetExpiredUploads() ([]types.TusUpload, error)
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateUpload(req types.CreateTusUploadReq) (types.TusUpload, error) {
+	var upload types.TusUpload
+
+	query := `INSERT INTO tus_uploads (id, creator, filename, description, metadata, upload_length, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, creator, filename, description, metadata, upload_length, upload_offset, COALESCE(asset_filename, ''), expires_at, created_at, updated_at`
+
+	err := r.db.QueryRow(query, req.ID, req.Creator, req.Filename, req.Description, req.Metadata, req.Length, req.ExpiresAt).Scan(&upload.ID, &upload.Creator, &upload.Filename, &upload.Description, &upload.Metadata, &upload.Length, &upload.Offset, &upload.AssetFilename, &upload.ExpiresAt, &upload.CreatedAt, &upload.UpdatedAt)
+	if err != nil {
+		return upload, err
+	}
+
+	return upload, nil
+}
+
+func (r *Repository) GetUpload(id string) (types.TusUpload, error) {
+	var upload types.TusUpload
+
+	query := `SELECT id, creator, filename, description, metadata, upload_length, upload_offset, COALESCE(asset_filename, ''), expires_at, created_at, updated_at FROM tus_uploads WHERE id = $1`
+
+	err := r.db.QueryRow(query, id).Scan(&upload.ID, &upload.Creator, &upload.Filename, &upload.Description, &upload.Metadata, &upload.Length, &upload.Offset, &upload.AssetFilename, &upload.ExpiresAt, &upload.CreatedAt, &upload.UpdatedAt)
+	if err != nil {
+		return upload, err
+	}
+
+	return upload, nil
+}
+
+func (r *Repository) UpdateOffset(id string, offset int64) error {
+	query := `UPDATE tus_uploads SET upload_offset = $2 WHERE id = $1`
+
+	_, err := r.db.Exec(query, id, offset)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) CompleteUpload(id string, assetFilename string) error {
+	query := `UPDATE tus_uploads SET asset_filename = $2 WHERE id = $1`
+
+	_, err := r.db.Exec(query, id, assetFilename)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) DeleteUpload(id string) error {
+	query := `DELETE FROM tus_uploads WHERE id = $1`
+
+	_, err := r.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) GetExpiredUploads() ([]types.TusUpload, error) {
+	var uploads []types.TusUpload
+
+	query := `SELECT id, creator, filename, description, metadata, upload_length, upload_offset, COALESCE(asset_filename, ''), expires_at, created_at, updated_at FROM tus_uploads WHERE expires_at < NOW()`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return uploads, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var upload types.TusUpload
+		if err := rows.Scan(&upload.ID, &upload.Creator, &upload.Filename, &upload.Description, &upload.Metadata, &upload.Length, &upload.Offset, &upload.AssetFilename, &upload.ExpiresAt, &upload.CreatedAt, &upload.UpdatedAt); err != nil {
+			return uploads, err
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, nil
+}
@@ -0,0 +1,321 @@
+package tus
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/okanay/file-upload-go/internal/upload"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Service struct {
+	repository    *Repository
+	uploadService *upload.Service
+	locks         sync.Map
+}
+
+func NewService(r *Repository, u *upload.Service) *Service {
+	service := &Service{
+		repository:    r,
+		uploadService: u,
+	}
+
+	go service.expirationRoutine()
+	return service
+}
+
+func (s *Service) CreateUpload(creator string, length int64, metadata string) (types.TusUpload, error) {
+	values := ParseMetadata(metadata)
+
+	filename := filepath.Base(values["filename"])
+	if filename == "" || filename == "." || filename == "/" {
+		return types.TusUpload{}, httperrors.NewHttpError("Upload-Metadata must contain a 'filename' key.", http.StatusBadRequest)
+	}
+
+	// Reject disallowed types before the client sends any bytes
+	err := s.uploadService.CheckFileExtension(filename)
+	if err != nil {
+		return types.TusUpload{}, httperrors.NewHttpError("Invalid file type: "+err.Error(), http.StatusBadRequest)
+	}
+
+	if value := values["collection"]; value != "" {
+		collection, err := strconv.Atoi(value)
+		if err != nil || collection < 1 {
+			return types.TusUpload{}, httperrors.NewHttpError("Collection must be a collection id.", http.StatusBadRequest)
+		}
+		if err := s.uploadService.CheckCollection(collection); err != nil {
+			return types.TusUpload{}, err
+		}
+	}
+
+	if length > MaxSize() {
+		return types.TusUpload{}, httperrors.NewHttpError("Max upload size exceeded.", http.StatusRequestEntityTooLarge)
+	}
+
+	if err := os.MkdirAll(TUS_UPLOAD_DIR, os.ModePerm); err != nil {
+		return types.TusUpload{}, err
+	}
+
+	id := strings.ReplaceAll(uuid.New().String(), "-", "")
+
+	// Create empty file for the incoming chunks
+	dst, err := os.Create(s.uploadPath(id))
+	if err != nil {
+		return types.TusUpload{}, err
+	}
+	dst.Close()
+
+	upload, err := s.repository.CreateUpload(types.CreateTusUploadReq{
+		ID:          id,
+		Creator:     creator,
+		Filename:    filename,
+		Description: values["description"],
+		Metadata:    metadata,
+		Length:      length,
+		ExpiresAt:   time.Now().Add(TUS_EXPIRATION),
+	})
+	if err != nil {
+		_ = os.Remove(s.uploadPath(id))
+		return types.TusUpload{}, err
+	}
+
+	fmt.Println("[TUS UPLOAD] Upload created:", upload.ID, upload.Filename)
+
+	// No PATCH ever completes an empty upload
+	if length == 0 {
+		asset, err := s.finishUpload(upload)
+		if err != nil {
+			return upload, err
+		}
+		upload.AssetFilename = asset.Filename
+	}
+
+	return upload, nil
+}
+
+// MaxSize is the largest upload accepted. The assembled file goes through
+// the regular upload flow, so its limit applies as well.
+func MaxSize() int64 {
+	return min(TUS_MAX_SIZE, upload.MAX_UPLOAD_SIZE)
+}
+
+// GetUpload returns an upload of the creator. Uploads of other users are
+// not found, so their ids can't be probed.
+func (s *Service) GetUpload(id, creator string) (types.TusUpload, error) {
+	upload, err := s.repository.GetUpload(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && upload.Creator != creator) {
+		return types.TusUpload{}, httperrors.NewHttpError("Upload not found.", http.StatusNotFound)
+	}
+	if err != nil {
+		return upload, err
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		return upload, httperrors.NewHttpError("Upload has expired.", http.StatusGone)
+	}
+
+	return upload, nil
+}
+
+// WriteChunk appends body to the upload at the given offset. Bytes received
+// before a dropped connection are kept so the client can resume from there.
+// When the last byte arrives the file goes through the regular upload flow.
+func (s *Service) WriteChunk(id, creator string, offset int64, body io.Reader) (types.TusUpload, error) {
+	// Only known uploads get a lock, unknown ids would never release theirs
+	if upload, err := s.GetUpload(id, creator); err != nil {
+		return upload, err
+	}
+
+	lock := s.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	upload, err := s.GetUpload(id, creator)
+	if err != nil {
+		return upload, err
+	}
+
+	if upload.AssetFilename != "" {
+		return upload, httperrors.NewHttpError("Upload is already completed.", http.StatusForbidden)
+	}
+
+	if offset != upload.Offset {
+		return upload, httperrors.NewHttpError(fmt.Sprintf("Upload-Offset mismatch, expected %d.", upload.Offset), http.StatusConflict)
+	}
+
+	dst, err := os.OpenFile(s.uploadPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return upload, err
+	}
+
+	_, err = dst.Seek(offset, io.SeekStart)
+	if err != nil {
+		dst.Close()
+		return upload, err
+	}
+
+	written, copyErr := io.Copy(dst, io.LimitReader(body, upload.Length-offset))
+	dst.Close()
+
+	upload.Offset = offset + written
+	if err := s.repository.UpdateOffset(id, upload.Offset); err != nil {
+		return upload, err
+	}
+
+	if copyErr != nil {
+		return upload, copyErr
+	}
+
+	if upload.Offset == upload.Length {
+		asset, err := s.finishUpload(upload)
+		if err != nil {
+			return upload, err
+		}
+		upload.AssetFilename = asset.Filename
+
+		// Completed uploads reject every write, they need no lock anymore
+		s.locks.Delete(id)
+	}
+
+	return upload, nil
+}
+
+func (s *Service) TerminateUpload(id, creator string) error {
+	if _, err := s.GetUpload(id, creator); err != nil {
+		return err
+	}
+
+	lock := s.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	_, err := s.GetUpload(id, creator)
+	if err != nil {
+		return err
+	}
+
+	return s.removeUpload(id)
+}
+
+func (s *Service) finishUpload(upload types.TusUpload) (types.Assets, error) {
+	file, err := os.Open(s.uploadPath(upload.ID))
+	if err != nil {
+		return types.Assets{}, err
+	}
+	defer file.Close()
+
+	header := &multipart.FileHeader{Filename: upload.Filename, Size: upload.Length}
+	metadata := ParseMetadata(upload.Metadata)
+	collection, _ := strconv.Atoi(metadata["collection"])
+	asset, err := s.uploadService.ProcessUpload(file, header, types.UploadOptions{
+		Creator:     upload.Creator,
+		Description: upload.Description,
+		Dedupe:      metadata["dedupe"],
+		Visibility:  metadata["visibility"],
+		Ingest:      metadata["ingest"],
+		Tags:        strings.Split(metadata["tags"], ","),
+		Collection:  collection,
+	})
+	if err != nil {
+		// The assembled file can never be accepted, so do not keep it around
+		_ = s.removeUpload(upload.ID)
+		return asset, err
+	}
+
+	if err := s.repository.CompleteUpload(upload.ID, asset.Filename); err != nil {
+		return asset, err
+	}
+	_ = os.Remove(s.uploadPath(upload.ID))
+
+	fmt.Println("[TUS UPLOAD] Upload completed:", upload.ID, asset.Filename)
+	return asset, nil
+}
+
+func (s *Service) removeUpload(id string) error {
+	if err := os.Remove(s.uploadPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := s.repository.DeleteUpload(id); err != nil {
+		return err
+	}
+
+	s.locks.Delete(id)
+	return nil
+}
+
+func (s *Service) expirationRoutine() {
+	ticker := time.NewTicker(TUS_CLEANUP_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.cleanExpiredUploads()
+	}
+}
+
+func (s *Service) cleanExpiredUploads() {
+	uploads, err := s.repository.GetExpiredUploads()
+	if err != nil {
+		fmt.Println("[TUS CLEANER] Error fetching expired uploads:", err)
+		return
+	}
+
+	for _, upload := range uploads {
+		lock := s.lock(upload.ID)
+		lock.Lock()
+		err := s.removeUpload(upload.ID)
+		lock.Unlock()
+
+		if err != nil {
+			fmt.Println("[TUS CLEANER] Error removing upload", upload.ID, err)
+			continue
+		}
+		fmt.Println("[TUS CLEANER] Expired upload has been removed:", upload.ID)
+	}
+}
+
+func (s *Service) lock(id string) *sync.Mutex {
+	lock, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+func (s *Service) uploadPath(id string) string {
+	return filepath.Join(TUS_UPLOAD_DIR, id)
+}
+
+// ParseMetadata decodes an Upload-Metadata header ("key base64value,key2 base64value").
+func ParseMetadata(header string) map[string]string {
+	values := make(map[string]string)
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+
+		if len(parts) == 1 {
+			values[parts[0]] = ""
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			continue
+		}
+		values[parts[0]] = string(decoded)
+	}
+
+	return values
+}
@@ -0,0 +1,92 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"mime/multipart"
+	"net/http"
+)
+
+// ProcessBatch ingests every file on its own and returns one result per file,
+// in request order. descriptions are matched to files by position.
+//
+// When atomic is set the batch stops at the first failure and every asset it
+// created is removed again, files and database rows, so either all files are
+// stored or none. The returned error is the failure that caused the rollback.
+func (s *Service) ProcessBatch(headers []*multipart.FileHeader, descriptions []string, opts types.UploadOptions, atomic bool) ([]types.UploadResult, error) {
+	results := make([]types.UploadResult, len(headers))
+	created := []int{}
+
+	for i, header := range headers {
+		results[i].File = header.Filename
+
+		fileOpts := opts
+		fileOpts.Description = ""
+		if i < len(descriptions) {
+			fileOpts.Description = descriptions[i]
+		}
+
+		asset, isNew, err := s.processBatchFile(header, fileOpts)
+		if err != nil {
+			results[i].Status = types.UploadFailed
+			results[i].Error = httperrors.Handle(err).Message
+
+			if atomic {
+				for j := i + 1; j < len(headers); j++ {
+					results[j] = types.UploadResult{File: headers[j].Filename, Status: types.UploadSkipped}
+				}
+				s.rollbackBatch(results, created)
+				return results, err
+			}
+			continue
+		}
+
+		results[i].Status = types.UploadCreated
+		results[i].Asset = &asset
+		if isNew {
+			created = append(created, i)
+		}
+	}
+
+	return results, nil
+}
+
+func (s *Service) processBatchFile(header *multipart.FileHeader, opts types.UploadOptions) (types.Assets, bool, error) {
+	if header.Size > MAX_UPLOAD_SIZE {
+		return types.Assets{}, false, httperrors.NewHttpError("Max upload size exceeded.", http.StatusRequestEntityTooLarge)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return types.Assets{}, false, httperrors.NewHttpError("Could not read file: "+err.Error(), http.StatusBadRequest)
+	}
+	defer file.Close()
+
+	return s.processUpload(file, header, opts)
+}
+
+// rollbackBatch undoes the assets created by an atomic batch, newest first.
+// Duplicates that point at an asset from before the batch are left alone.
+func (s *Service) rollbackBatch(results []types.UploadResult, created []int) {
+	for k := len(created) - 1; k >= 0; k-- {
+		result := &results[created[k]]
+		asset := result.Asset
+
+		orphanedKey, err := s.uploadRepo.DeleteAssetRecord(asset.Filename)
+		if err != nil {
+			fmt.Println("[UPLOAD BATCH] Error rolling back asset:", asset.Filename, err)
+			continue
+		}
+		if orphanedKey != "" {
+			if err := s.storage.Delete(context.Background(), orphanedKey); err != nil {
+				fmt.Println("[UPLOAD BATCH] Error deleting file:", orphanedKey, err)
+			}
+		}
+		s.deleteArchive(asset.ArchiveKey)
+
+		result.Status = types.UploadRolledBack
+		result.Asset = nil
+	}
+}
@@ -2,3 +2,34 @@ package upload
 
 var MAX_UPLOAD_SIZE int64 = 8 * 1024 * 1024
 var ALLOWED_EXTENSIONS []string = []string{".jpg", ".jpeg", ".png", ".webp"}
+
+// ALLOWED_MIME_TYPES maps every allowed extension to the content type its
+// bytes must be detected as.
+var ALLOWED_MIME_TYPES = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+}
+
+// DEFAULT_INGEST_MODE is used when an upload does not ask for one. Strip
+// removes location and personal metadata before the file is stored.
+var DEFAULT_INGEST_MODE = "strip"
+
+// ARCHIVE_DIR holds the untouched originals of uploads in archive mode. It is
+// never served.
+var ARCHIVE_DIR = "archive"
+
+// AUTO_ORIENT_QUALITY is the JPEG quality used when a photo has to be
+// re-encoded to apply its orientation.
+var AUTO_ORIENT_QUALITY = 95
+
+// MAX_BATCH_FILES is the most files accepted in one upload request.
+var MAX_BATCH_FILES = 50
+
+// ZIP uploads are checked against these limits before anything is extracted,
+// so archives built to expand into huge amounts of data are rejected early.
+var MAX_ZIP_SIZE int64 = 256 * 1024 * 1024
+var MAX_ZIP_ENTRIES = 500
+var MAX_ZIP_UNCOMPRESSED_SIZE int64 = 1024 * 1024 * 1024
+var MAX_ZIP_COMPRESSION_RATIO int64 = 100
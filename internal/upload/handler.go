@@ -1,10 +1,16 @@
 package upload
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/okanay/file-upload-go/db"
 	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type Handler struct {
@@ -17,16 +23,35 @@ func NewHandler(s *Service) *Handler {
 	}
 }
 
+// UploadFile stores the files sent under the 'file' key. A single file is
+// answered with its asset; several files are a batch, answered with one
+// result per file. A batch with 'atomic=true' stores all files or none.
 func (h *Handler) UploadFile(c *gin.Context) {
-	file, header, err := c.Request.FormFile("file")
-	defer file.Close()
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["file"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required. Please use FormData with 'file' key."})
+		return
+	}
+
+	headers := form.File["file"]
+	opts, err := uploadOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(headers) > 1 {
+		h.uploadBatch(c, headers, opts)
+		return
+	}
 
-	// Check if file extension is allowed
-	err = h.service.CheckFileType(header)
+	header := headers[0]
+	file, err := header.Open()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required. Please use FormData with 'file' key."})
 		return
 	}
+	defer file.Close()
 
 	// Check if file bigger than max upload size
 	if header.Size > MAX_UPLOAD_SIZE {
@@ -34,36 +59,104 @@ func (h *Handler) UploadFile(c *gin.Context) {
 		return
 	}
 
-	uniqueFileName := h.service.CreateUniqueFileName(header)
-	// Create record for database
-	assetReq := types.CreateAssetReq{
-		Creator:     "admin",
-		Name:        uniqueFileName.ID,
-		Type:        uniqueFileName.Type,
-		Filename:    uniqueFileName.IdWithExt,
-		Description: c.PostForm("description"),
-		Size:        header.Size,
+	opts.Description = c.PostForm("description")
+	asset, err := h.service.ProcessUpload(file, header, opts)
+	if err != nil {
+		response := httperrors.Handle(err)
+		c.JSON(response.Status, gin.H{"error": response.Message})
+		return
+	}
+
+	// Return response
+	c.JSON(http.StatusOK, gin.H{
+		"asset": asset,
+	})
+}
+
+// UploadZip extracts a ZIP archive sent under the 'file' key and stores each
+// image in it as an asset.
+func (h *Handler) UploadZip(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required. Please use FormData with 'file' key."})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > MAX_ZIP_SIZE {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Max ZIP size exceeded."})
+		return
 	}
 
-	// Save file
-	err = h.service.SaveAssetImage(file, uniqueFileName)
+	opts, err := uploadOptions(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving file: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	opts.Description = c.PostForm("description")
 
-	// Save record to database
-	asset, err := h.service.uploadRepo.CreateAssetRecord(assetReq)
+	results, err := h.service.ProcessZip(file, header.Size, opts)
 	if err != nil {
-		err = h.service.DeleteImage(uniqueFileName.IdWithExt)
+		response := httperrors.Handle(err)
+		c.JSON(response.Status, gin.H{"error": response.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, resultSummary(results))
+}
+
+// uploadOptions reads the form fields shared by every file of an upload.
+// Tags can be sent as repeated 'tags' fields or comma separated.
+func uploadOptions(c *gin.Context) (types.UploadOptions, error) {
+	opts := types.UploadOptions{
+		Creator:    db.CurrentUser(c).Username,
+		Dedupe:     c.PostForm("dedupe"),
+		Visibility: c.PostForm("visibility"),
+		Ingest:     c.PostForm("ingest"),
+	}
+
+	for _, value := range c.PostFormArray("tags") {
+		opts.Tags = append(opts.Tags, strings.Split(value, ",")...)
+	}
+
+	if value := c.PostForm("collection"); value != "" {
+		collection, err := strconv.Atoi(value)
+		if err != nil || collection < 1 {
+			return opts, errors.New("Collection must be a collection id.")
+		}
+		opts.Collection = collection
+	}
+
+	return opts, nil
+}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating asset: " + err.Error()})
+func (h *Handler) uploadBatch(c *gin.Context, headers []*multipart.FileHeader, opts types.UploadOptions) {
+	if len(headers) > MAX_BATCH_FILES {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d files can be uploaded at once.", MAX_BATCH_FILES)})
 		return
 	}
 
-	fmt.Println("[UPLOAD ASSET] Asset created: ", asset)
-	// Return response
-	c.JSON(http.StatusOK, gin.H{
-		"asset": asset,
-	})
+	atomic := c.PostForm("atomic") == "true"
+	results, err := h.service.ProcessBatch(headers, c.PostFormArray("description"), opts, atomic)
+	if err != nil {
+		response := httperrors.Handle(err)
+		c.JSON(response.Status, gin.H{"error": "Batch rolled back: " + response.Message, "results": results})
+		return
+	}
+
+	c.JSON(http.StatusOK, resultSummary(results))
+}
+
+func resultSummary(results []types.UploadResult) gin.H {
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	return gin.H{
+		"results":   results,
+		"succeeded": counts[types.UploadCreated],
+		"failed":    counts[types.UploadFailed],
+		"skipped":   counts[types.UploadSkipped],
+	}
 }
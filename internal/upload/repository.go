@@ -2,7 +2,11 @@ package upload
 
 import (
 	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/okanay/file-upload-go/storage"
 	"github.com/okanay/file-upload-go/types"
+	"strings"
 )
 
 type Repository struct {
@@ -10,22 +14,120 @@ type Repository struct {
 }
 
 type IRepository interface {
-	CreateAssetRecord(req types.CreateAssetReq) (types.Assets, error)
+	CreateAssetRecord(req types.CreateAssetReq) (types.Assets, string, error)
+	GetAssetWithHash(hash, creator, visibility string) (types.Assets, error)
 	GetAllAssets() ([]types.Assets, error)
+	DeleteAssetRecord(filename string) (string, error)
+	CollectionExists(id int) (bool, error)
 }
 
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) CreateAssetRecord(req types.CreateAssetReq) (types.Assets, error) {
+// CreateAssetRecord inserts the asset and takes a reference on its blob. When
+// the hash is new the blob is registered under the asset's filename,
+// otherwise the returned asset points at the already stored blob.
+//
+// A blob that only trashed assets use lives in the trash folder. It is moved
+// to the asset's file instead, and the trash key that is no longer needed is
+// returned so the caller can delete it.
+func (r *Repository) CreateAssetRecord(req types.CreateAssetReq) (types.Assets, string, error) {
 	var asset types.Assets
+	var replacedKey string
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return asset, "", err
+	}
+	defer tx.Rollback()
+
+	if req.Hash != "" {
+		var storageKey string
+		err = tx.QueryRow(`SELECT storage_key FROM blobs WHERE hash = $1 FOR UPDATE`, req.Hash).Scan(&storageKey)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return asset, "", err
+		}
+		if strings.HasPrefix(storageKey, storage.TrashDir+"/") {
+			if _, err := tx.Exec(`UPDATE blobs SET storage_key = $2 WHERE hash = $1`, req.Hash, req.Filename); err != nil {
+				return asset, "", err
+			}
+			replacedKey = storageKey
+		}
+
+		blobQuery := `INSERT INTO blobs (hash, storage_key, size, mime_type, ref_count) VALUES ($1, $2, $3, $4, 1) ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1`
+
+		_, err = tx.Exec(blobQuery, req.Hash, req.Filename, req.Size, req.MimeType)
+		if err != nil {
+			return asset, "", err
+		}
+	}
 
 	// SQL sorgusunu hazırla
-	query := `INSERT INTO assets (creator, name, type, filename, description, size) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, creator, name, type, filename, description, size, created_at, updated_at`
+	query := `INSERT INTO assets (creator, name, type, mime_type, filename, description, size, hash, visibility, blur_hash, thumb_hash,
+			width, height, orientation, camera_make, camera_model, lens_model, taken_at, exposure_time, f_number, iso, focal_length,
+			gps_latitude, gps_longitude, color_space, dominant_colors, metadata, processing, archive_key, original_filename)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, NULLIF($10, ''), NULLIF($11, ''),
+			$12, $13, NULLIF($14, 0), NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, ''), $18, NULLIF($19, ''), NULLIF($20::real, 0), NULLIF($21, 0), NULLIF($22::real, 0),
+			$23, $24, NULLIF($25, ''), $26, $27, $28, NULLIF($29, ''), NULLIF($30, ''))
+		RETURNING ` + types.AssetColumns(31)
 
 	// SQL sorgusunu çalıştır
-	err := r.db.QueryRow(query, req.Creator, req.Name, req.Type, req.Filename, req.Description, req.Size).Scan(&asset.ID, &asset.Creator, &asset.Name, &asset.Type, &asset.Filename, &asset.Description, &asset.Size, &asset.CreatedAt, &asset.UpdatedAt)
+	m := req.Metadata
+	err = tx.QueryRow(query, req.Creator, req.Name, req.Type, req.MimeType, req.Filename, req.Description, req.Size, req.Hash, req.Visibility, req.BlurHash, req.ThumbHash,
+		m.Width, m.Height, m.Orientation, m.CameraMake, m.CameraModel, m.LensModel, m.TakenAt, m.ExposureTime, m.FNumber, m.ISO, m.FocalLength,
+		m.GPSLatitude, m.GPSLongitude, m.ColorSpace, pq.Array(m.DominantColors), m.EXIF, req.Processing, req.ArchiveKey, req.OriginalFilename, storage.TrashDir).Scan(asset.ScanFields()...)
+	if err != nil {
+		return asset, "", err
+	}
+
+	if len(req.Tags) > 0 {
+		if err := tagAsset(tx, asset.ID, req.Tags); err != nil {
+			return asset, "", err
+		}
+		asset.Tags = req.Tags
+	}
+
+	if req.Collection > 0 {
+		_, err := tx.Exec(`INSERT INTO collection_assets (collection_id, asset_id) VALUES ($1, $2)`, req.Collection, asset.ID)
+		if err != nil {
+			return asset, "", err
+		}
+		asset.Collections = []int64{int64(req.Collection)}
+	}
+
+	return asset, replacedKey, tx.Commit()
+}
+
+func (r *Repository) CollectionExists(id int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM collections WHERE id = $1)`, id).Scan(&exists)
+	return exists, err
+}
+
+// tagAsset creates the tags that don't exist yet and links all of them to
+// the asset.
+func tagAsset(tx *sql.Tx, assetID int, tags []string) error {
+	_, err := tx.Exec(`INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING`, pq.Array(tags))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO asset_tags (asset_id, tag_id) SELECT $1, id FROM tags WHERE name = ANY($2) ON CONFLICT DO NOTHING`, assetID, pq.Array(tags))
+	return err
+}
+
+// GetAssetWithHash returns a live asset with the content and visibility that
+// the creator may see: one of their own, or a public one. Their own assets
+// come first.
+func (r *Repository) GetAssetWithHash(hash, creator, visibility string) (types.Assets, error) {
+	var asset types.Assets
+
+	query := `SELECT ` + types.AssetColumns(4) + ` FROM assets
+		WHERE hash = $1 AND deleted_at IS NULL AND visibility = $3 AND (creator = $2 OR visibility = 'public')
+		ORDER BY creator = $2 DESC, id LIMIT 1`
+
+	err := r.db.QueryRow(query, hash, creator, visibility, storage.TrashDir).Scan(asset.ScanFields()...)
 	if err != nil {
 		return asset, err
 	}
@@ -37,10 +139,10 @@ func (r *Repository) GetAllAssets() ([]types.Assets, error) {
 	var assets []types.Assets
 
 	// SQL sorgusunu hazırla
-	query := `SELECT id, creator, name, type, filename, description, size, created_at, updated_at FROM assets`
+	query := `SELECT ` + types.AssetColumns(1) + ` FROM assets WHERE deleted_at IS NULL`
 
 	// SQL sorgusunu çalıştır
-	rows, err := r.db.Query(query)
+	rows, err := r.db.Query(query, storage.TrashDir)
 	if err != nil {
 		return assets, err
 	}
@@ -49,7 +151,7 @@ func (r *Repository) GetAllAssets() ([]types.Assets, error) {
 	// SQL sorgusundan dönen verileri diziye çevir
 	for rows.Next() {
 		var asset types.Assets
-		if err := rows.Scan(&asset.ID, &asset.Creator, &asset.Name, &asset.Type, &asset.Filename, &asset.Description, &asset.Size, &asset.CreatedAt, &asset.UpdatedAt); err != nil {
+		if err := rows.Scan(asset.ScanFields()...); err != nil {
 			return assets, err
 		}
 		assets = append(assets, asset)
@@ -57,3 +159,42 @@ func (r *Repository) GetAllAssets() ([]types.Assets, error) {
 
 	return assets, nil
 }
+
+// DeleteAssetRecord removes an asset created by a failed batch and drops its
+// reference on the blob. It returns the storage key when the blob is no
+// longer used and its file has to be deleted.
+func (r *Repository) DeleteAssetRecord(filename string) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var hash sql.NullString
+	err = tx.QueryRow(`DELETE FROM assets WHERE filename = $1 RETURNING hash`, filename).Scan(&hash)
+	if err != nil {
+		return "", err
+	}
+
+	if !hash.Valid {
+		return filename, tx.Commit()
+	}
+
+	var refCount int
+	var storageKey string
+	err = tx.QueryRow(`UPDATE blobs SET ref_count = ref_count - 1 WHERE hash = $1 RETURNING ref_count, storage_key`, hash.String).Scan(&refCount, &storageKey)
+	if err != nil {
+		return "", err
+	}
+
+	if refCount > 0 {
+		return "", tx.Commit()
+	}
+
+	_, err = tx.Exec(`DELETE FROM blobs WHERE hash = $1`, hash.String)
+	if err != nil {
+		return "", err
+	}
+
+	return storageKey, tx.Commit()
+}
@@ -1,22 +1,279 @@
 package upload
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"github.com/gabriel-vasile/mimetype"
 	"github.com/google/uuid"
+	"github.com/okanay/file-upload-go/storage"
 	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"github.com/okanay/file-upload-go/utils/metadata"
+	"github.com/okanay/file-upload-go/utils/placeholder"
 	"io"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
 type Service struct {
 	uploadRepo *Repository
+	storage    storage.Storage
 }
 
-func NewService(r *Repository) *Service {
-	return &Service{uploadRepo: r}
+func NewService(r *Repository, s storage.Storage) *Service {
+	return &Service{uploadRepo: r, storage: s}
+}
+
+// ProcessUpload runs the shared ingest flow for a single file: type check,
+// storage and database record. It is used by every upload entry point.
+func (s *Service) ProcessUpload(file multipart.File, header *multipart.FileHeader, opts types.UploadOptions) (types.Assets, error) {
+	asset, _, err := s.processUpload(file, header, opts)
+	return asset, err
+}
+
+// processUpload also reports whether a new asset was created, which is not
+// the case when an existing duplicate is returned.
+func (s *Service) processUpload(file multipart.File, header *multipart.FileHeader, opts types.UploadOptions) (types.Assets, bool, error) {
+	if opts.Dedupe != "" && opts.Dedupe != types.DedupeReuse && opts.Dedupe != types.DedupeExisting {
+		return types.Assets{}, false, httperrors.NewHttpError("Dedupe must be 'reuse' or 'existing'.", http.StatusBadRequest)
+	}
+
+	if opts.Visibility == "" {
+		opts.Visibility = types.VisibilityPublic
+	}
+	if opts.Visibility != types.VisibilityPublic && opts.Visibility != types.VisibilityPrivate {
+		return types.Assets{}, false, httperrors.NewHttpError("Visibility must be 'public' or 'private'.", http.StatusBadRequest)
+	}
+
+	if opts.Collection > 0 {
+		if err := s.CheckCollection(opts.Collection); err != nil {
+			return types.Assets{}, false, err
+		}
+	}
+
+	staged, err := s.stageContent(file, header, opts)
+	if err != nil {
+		return types.Assets{}, false, err
+	}
+	defer staged.close()
+
+	// Looked up before anything is written to storage
+	if opts.Dedupe == types.DedupeExisting {
+		hash, err := hashContent(staged.stored)
+		if err != nil {
+			return types.Assets{}, false, err
+		}
+
+		existing, err := s.uploadRepo.GetAssetWithHash(hash, opts.Creator, opts.Visibility)
+		if err == nil {
+			existing.Duplicate = true
+			fmt.Println("[UPLOAD ASSET] Duplicate of existing asset: ", existing.Filename)
+			return existing, false, nil
+		}
+	}
+
+	content, err := s.saveContent(file, staged)
+	if err != nil {
+		return types.Assets{}, false, err
+	}
+
+	// Create record for database
+	assetReq := content
+	assetReq.Creator = opts.Creator
+	assetReq.OriginalFilename = filepath.Base(header.Filename)
+	assetReq.Description = opts.Description
+	assetReq.Visibility = opts.Visibility
+	assetReq.Tags = utils.NormalizeTags(opts.Tags)
+	assetReq.Collection = opts.Collection
+
+	// Save record to database
+	asset, replacedKey, err := s.uploadRepo.CreateAssetRecord(assetReq)
+	if err != nil {
+		s.DiscardContent(content)
+		return types.Assets{}, false, httperrors.NewHttpError("Error creating asset: "+err.Error(), http.StatusInternalServerError)
+	}
+
+	s.SettleContent(content, asset.StorageKey, replacedKey)
+	asset.Duplicate = asset.StorageKey != content.Filename
+
+	fmt.Println("[UPLOAD ASSET] Asset created: ", asset)
+	return asset, true, nil
+}
+
+// StoreContent runs the ingest steps that don't depend on an asset row: type
+// check, metadata stripping, storage and analysis. The returned request has
+// the content fields of an asset filled in, the stored file is under its
+// Filename. Callers that can't use the content hand it to DiscardContent.
+func (s *Service) StoreContent(file multipart.File, header *multipart.FileHeader, opts types.UploadOptions) (types.CreateAssetReq, error) {
+	staged, err := s.stageContent(file, header, opts)
+	if err != nil {
+		return types.CreateAssetReq{}, err
+	}
+	defer staged.close()
+
+	return s.saveContent(file, staged)
+}
+
+// stagedContent is an upload that passed the checks and is ready to be
+// stored. stored is the file itself, or its stripped copy.
+type stagedContent struct {
+	mimeType string
+	name     types.UniqueFileName
+	stored   multipart.File
+	stripped *os.File
+	process  types.Processing
+}
+
+func (c stagedContent) close() {
+	if c.stripped != nil {
+		c.stripped.Close()
+		os.Remove(c.stripped.Name())
+	}
+}
+
+// stageContent checks an upload and strips its metadata into a temporary
+// file, without writing anything to storage.
+func (s *Service) stageContent(file multipart.File, header *multipart.FileHeader, opts types.UploadOptions) (stagedContent, error) {
+	// Check if file extension and content are allowed
+	mimeType, err := s.CheckFileType(file, header)
+	if err != nil {
+		return stagedContent{}, httperrors.NewHttpError("Invalid file type: "+err.Error(), http.StatusBadRequest)
+	}
+
+	// Rejected before anything decodes the full image
+	if err := metadata.CheckPixels(file); err != nil {
+		return stagedContent{}, httperrors.NewHttpError("Invalid image: "+err.Error(), http.StatusRequestEntityTooLarge)
+	}
+
+	if opts.Ingest == "" {
+		opts.Ingest = DEFAULT_INGEST_MODE
+	}
+	if opts.Ingest != types.IngestKeep && opts.Ingest != types.IngestStrip && opts.Ingest != types.IngestArchive {
+		return stagedContent{}, httperrors.NewHttpError("Ingest must be 'keep', 'strip' or 'archive'.", http.StatusBadRequest)
+	}
+
+	staged := stagedContent{
+		mimeType: mimeType,
+		name:     s.CreateUniqueFileName(header),
+		stored:   file,
+		process:  types.Processing{Mode: opts.Ingest},
+	}
+	if opts.Ingest == types.IngestArchive {
+		staged.process.Archived = true
+		staged.process.Steps = append(staged.process.Steps, types.StepArchiveOriginal)
+	}
+
+	// The stored file is the stripped copy, the original stays open for the
+	// metadata that is kept
+	if opts.Ingest != types.IngestKeep {
+		stripped, steps, err := s.StripImage(file, staged.name.Type)
+		if err != nil {
+			return stagedContent{}, httperrors.NewHttpError("Could not process image: "+err.Error(), http.StatusBadRequest)
+		}
+
+		staged.stripped = stripped
+		staged.stored = stripped
+		staged.process.Steps = append(staged.process.Steps, steps...)
+	}
+
+	return staged, nil
+}
+
+// saveContent archives the original when asked to, stores the staged file
+// and analyzes the image.
+func (s *Service) saveContent(file multipart.File, staged stagedContent) (types.CreateAssetReq, error) {
+	processing := staged.process
+	archiveKey := ""
+	if processing.Archived {
+		archiveKey = ARCHIVE_DIR + "/" + staged.name.IdWithExt
+		if _, _, err := s.SaveFile(file, archiveKey, staged.mimeType); err != nil {
+			return types.CreateAssetReq{}, httperrors.NewHttpError("Error archiving file: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	// Save file
+	hash, size, err := s.SaveAssetImage(staged.stored, staged.name)
+	if err != nil {
+		s.deleteArchive(archiveKey)
+		return types.CreateAssetReq{}, httperrors.NewHttpError("Error saving file: "+err.Error(), http.StatusInternalServerError)
+	}
+
+	placeholders, meta := s.AnalyzeImage(file)
+	if processing.Mode != types.IngestKeep {
+		metadata.RemovePII(&meta)
+		if slices.Contains(processing.Steps, types.StepAutoOrient) {
+			meta.Orientation = 1
+		}
+	}
+
+	return types.CreateAssetReq{
+		Name:       staged.name.ID,
+		Type:       staged.name.Type,
+		MimeType:   staged.mimeType,
+		Filename:   staged.name.IdWithExt,
+		Size:       size,
+		Hash:       hash,
+		BlurHash:   placeholders.BlurHash,
+		ThumbHash:  placeholders.ThumbHash,
+		Metadata:   meta,
+		Processing: processing,
+		ArchiveKey: archiveKey,
+	}, nil
+}
+
+// hashContent returns the SHA-256 of a whole file, the same hash SaveFile
+// computes while storing it.
+func hashContent(file io.ReadSeeker) (string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+
+	_, err := file.Seek(0, io.SeekStart)
+	return hex.EncodeToString(hasher.Sum(nil)), err
+}
+
+// DiscardContent deletes the files of content that did not make it into the
+// database.
+func (s *Service) DiscardContent(content types.CreateAssetReq) {
+	_ = s.DeleteImage(content.Filename)
+	s.deleteArchive(content.ArchiveKey)
+}
+
+// SettleContent cleans up after content was recorded. storageKey is where
+// the recorded blob lives; when the same content was already stored the new
+// file is not needed. A trash key that the new file replaced is deleted too.
+func (s *Service) SettleContent(content types.CreateAssetReq, storageKey, replacedKey string) {
+	if replacedKey != "" {
+		_ = s.DeleteImage(replacedKey)
+	}
+	if storageKey != content.Filename {
+		_ = s.DeleteImage(content.Filename)
+	}
+}
+
+// CheckCollection fails when the collection uploads should be added to does
+// not exist.
+func (s *Service) CheckCollection(id int) error {
+	exists, err := s.uploadRepo.CollectionExists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return httperrors.NewHttpError("Collection not found.", http.StatusNotFound)
+	}
+	return nil
 }
 
 func (s *Service) CreateUniqueFileName(header *multipart.FileHeader) types.UniqueFileName {
@@ -44,49 +301,135 @@ func (s *Service) CreateUniqueFileName(header *multipart.FileHeader) types.Uniqu
 	}
 }
 
-func (s *Service) SaveAssetImage(file multipart.File, name types.UniqueFileName) error {
-	// ./public/my-file-name-12345678.jpg
-	publicDir := "./public"
-	if err := os.MkdirAll(publicDir, os.ModePerm); err != nil {
-		return err
+// SaveAssetImage stores the file under its unique name and returns the
+// SHA-256 and the size of the content, computed while streaming.
+func (s *Service) SaveAssetImage(file multipart.File, name types.UniqueFileName) (string, int64, error) {
+	// (12345678.jpg)
+	return s.SaveFile(file, name.IdWithExt, ALLOWED_MIME_TYPES[name.Type])
+}
+
+// SaveFile stores the whole file under key and returns its SHA-256 and size.
+func (s *Service) SaveFile(file io.ReadSeeker, key, contentType string) (string, int64, error) {
+	// Find out the size so storage backends can stream without buffering
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
 	}
 
-	// Create empty file
-	dst, err := os.Create(filepath.Join(publicDir, name.IdWithExt))
+	hasher := sha256.New()
+	err = s.storage.Put(context.Background(), key, io.TeeReader(file, hasher), size, contentType)
 	if err != nil {
-		return err
+		return "", 0, err
 	}
-	defer dst.Close()
 
-	// Write the content from POST to the empty file
-	_, err = io.Copy(dst, file)
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// StripImage writes a copy of the image without location and personal
+// metadata to a temporary file, which the caller removes. JPEG and PNG
+// photos get their EXIF orientation applied to the pixels; WebP keeps only
+// the orientation tag. It returns the processing steps that were applied.
+func (s *Service) StripImage(file io.ReadSeeker, ext string) (*os.File, []string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	orientation := metadata.Orientation(file)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "ingest-*"+ext)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	return nil
+	// Re-encoded files carry no metadata besides the color profile
+	var steps []string
+	if orientation > 1 && metadata.CanAutoOrient(ext) {
+		err = metadata.AutoOrient(file, tmp, ext, AUTO_ORIENT_QUALITY)
+		steps = append(steps, types.StepAutoOrient)
+	} else {
+		err = metadata.Strip(file, tmp, orientation)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, nil, err
+	}
+
+	return tmp, append(steps, types.StepStripMetadata), nil
+}
+
+func (s *Service) deleteArchive(key string) {
+	if key == "" {
+		return
+	}
+	if err := s.storage.Delete(context.Background(), key); err != nil {
+		fmt.Println("[UPLOAD ASSET] Error deleting archived original: ", key, err)
+	}
+}
+
+// AnalyzeImage extracts the metadata of an uploaded image and computes its
+// BlurHash and ThumbHash placeholders from a single decode. Both are
+// optional, an image that can't be decoded just gets what could be read.
+func (s *Service) AnalyzeImage(file io.ReadSeeker) (placeholder.Placeholders, types.ImageMetadata) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return placeholder.Placeholders{}, types.ImageMetadata{}
+	}
+
+	meta, img, err := metadata.Extract(file)
+	if err != nil {
+		fmt.Println("[UPLOAD ASSET] Could not decode image: ", err)
+		return placeholder.Placeholders{}, meta
+	}
+
+	placeholders, err := placeholder.Generate(img)
+	if err != nil {
+		fmt.Println("[UPLOAD ASSET] Could not generate placeholders: ", err)
+	}
+	return placeholders, meta
 }
 
 func (s *Service) DeleteImage(filename string) error {
-	// ./public/my-file-name-12345678.jpg
-	publicDir := "./public"
-	if err := os.MkdirAll(publicDir, os.ModePerm); err != nil {
-		return err
+	return s.storage.Delete(context.Background(), filename)
+}
+
+// CheckFileType validates the extension and detects the real type from the
+// file's magic bytes. It returns the detected MIME type.
+func (s *Service) CheckFileType(file io.ReadSeeker, header *multipart.FileHeader) (string, error) {
+	err := s.CheckFileExtension(header.Filename)
+	if err != nil {
+		return "", err
 	}
 
-	// Delete the file
-	err := os.Remove(filepath.Join(publicDir, filename))
+	detected, err := mimetype.DetectReader(file)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("Could not read file content: %v", err)
 	}
 
-	return nil
+	// Rewind so the file can be stored from the beginning
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	expected := ALLOWED_MIME_TYPES[filepath.Ext(header.Filename)]
+	if !detected.Is(expected) {
+		return "", fmt.Errorf("File content (%s) does not match the %s extension", detected.String(), filepath.Ext(header.Filename))
+	}
+
+	return expected, nil
 }
 
-func (s *Service) CheckFileType(header *multipart.FileHeader) error {
+func (s *Service) CheckFileExtension(filename string) error {
 	allowed := false
 	for _, ext := range ALLOWED_EXTENSIONS {
-		if ext == filepath.Ext(header.Filename) {
+		if ext == filepath.Ext(filename) {
 			allowed = true
 			break
 		}
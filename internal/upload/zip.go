@@ -0,0 +1,140 @@
+package upload
+
+import (
+	"archive/zip"
+	"fmt"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ProcessZip turns every allowed image in a ZIP archive into an asset and
+// returns one result per file entry. The folder an entry is in becomes a tag
+// of its asset. The archive is rejected as a whole when it breaks one of the
+// size limits.
+func (s *Service) ProcessZip(file io.ReaderAt, size int64, opts types.UploadOptions) ([]types.UploadResult, error) {
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return nil, httperrors.NewHttpError("Invalid ZIP archive: "+err.Error(), http.StatusBadRequest)
+	}
+
+	if err := checkZipLimits(archive); err != nil {
+		return nil, err
+	}
+
+	var results []types.UploadResult
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		result := types.UploadResult{File: entry.Name}
+		if skipZipEntry(entry.Name) {
+			result.Status = types.UploadSkipped
+			result.Error = "Not an allowed image file."
+			results = append(results, result)
+			continue
+		}
+
+		fileOpts := opts
+		if folder := zipFolder(entry.Name); folder != "" {
+			fileOpts.Tags = append(append([]string{}, opts.Tags...), folder)
+		}
+
+		asset, err := s.processZipEntry(entry, fileOpts)
+		if err != nil {
+			result.Status = types.UploadFailed
+			result.Error = httperrors.Handle(err).Message
+		} else {
+			result.Status = types.UploadCreated
+			result.Asset = &asset
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// checkZipLimits looks at the sizes declared in the central directory. The
+// declared sizes are enforced again while extracting, so lying about them
+// does not help.
+func checkZipLimits(archive *zip.Reader) error {
+	entries := 0
+	var total uint64
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		entries++
+		if entries > MAX_ZIP_ENTRIES {
+			return httperrors.NewHttpError(fmt.Sprintf("ZIP archive has more than %d files.", MAX_ZIP_ENTRIES), http.StatusRequestEntityTooLarge)
+		}
+
+		total += entry.UncompressedSize64
+		if total > uint64(MAX_ZIP_UNCOMPRESSED_SIZE) {
+			return httperrors.NewHttpError("ZIP archive expands beyond the allowed size.", http.StatusRequestEntityTooLarge)
+		}
+
+		if entry.UncompressedSize64 > 0 && entry.UncompressedSize64 > entry.CompressedSize64*uint64(MAX_ZIP_COMPRESSION_RATIO) {
+			return httperrors.NewHttpError("ZIP archive entry "+entry.Name+" exceeds the allowed compression ratio.", http.StatusBadRequest)
+		}
+	}
+
+	return nil
+}
+
+// skipZipEntry leaves out files that are not allowed images, including the
+// metadata folders and hidden files some archivers add.
+func skipZipEntry(name string) bool {
+	base := path.Base(name)
+	if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+		return true
+	}
+	_, allowed := ALLOWED_MIME_TYPES[filepath.Ext(base)]
+	return !allowed
+}
+
+// zipFolder is the cleaned folder path of an entry, empty at the root.
+func zipFolder(name string) string {
+	folder := path.Dir(path.Clean("/" + name))
+	return strings.Trim(folder, "/")
+}
+
+func (s *Service) processZipEntry(entry *zip.File, opts types.UploadOptions) (types.Assets, error) {
+	if entry.UncompressedSize64 > uint64(MAX_UPLOAD_SIZE) {
+		return types.Assets{}, httperrors.NewHttpError("Max upload size exceeded.", http.StatusRequestEntityTooLarge)
+	}
+
+	reader, err := entry.Open()
+	if err != nil {
+		return types.Assets{}, httperrors.NewHttpError("Could not read file: "+err.Error(), http.StatusBadRequest)
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp("", "zip-*"+filepath.Ext(entry.Name))
+	if err != nil {
+		return types.Assets{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Reading one byte past the declared size catches entries that lie
+	written, err := io.Copy(tmp, io.LimitReader(reader, int64(entry.UncompressedSize64)+1))
+	if err != nil {
+		return types.Assets{}, httperrors.NewHttpError("Could not read file: "+err.Error(), http.StatusBadRequest)
+	}
+	if written > int64(entry.UncompressedSize64) {
+		return types.Assets{}, httperrors.NewHttpError("File is larger than the ZIP archive declares.", http.StatusBadRequest)
+	}
+
+	header := &multipart.FileHeader{Filename: path.Base(entry.Name), Size: written}
+	asset, _, err := s.processUpload(tmp, header, opts)
+	return asset, err
+}
@@ -0,0 +1,143 @@
+package upload
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/okanay/file-upload-go/utils/httperrors"
+	"strings"
+	"testing"
+)
+
+type zipEntry struct {
+	name string
+	data []byte
+}
+
+func buildZip(t *testing.T, entries ...zipEntry) *zip.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := writer.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(entry.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func statusOf(err error) int {
+	var httpErr *httperrors.HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return 0
+}
+
+func TestCheckZipLimits(t *testing.T) {
+	savedEntries, savedSize, savedRatio := MAX_ZIP_ENTRIES, MAX_ZIP_UNCOMPRESSED_SIZE, MAX_ZIP_COMPRESSION_RATIO
+	MAX_ZIP_ENTRIES, MAX_ZIP_UNCOMPRESSED_SIZE, MAX_ZIP_COMPRESSION_RATIO = 3, 1000, 20
+	defer func() {
+		MAX_ZIP_ENTRIES, MAX_ZIP_UNCOMPRESSED_SIZE, MAX_ZIP_COMPRESSION_RATIO = savedEntries, savedSize, savedRatio
+	}()
+
+	// Random looking bytes barely compress
+	noise := func(n int) []byte {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i*7919 + i*i*31)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		status  int
+	}{
+		{"within limits", []zipEntry{{"a.jpg", noise(100)}, {"b.jpg", noise(100)}}, 0},
+		{"folders do not count", []zipEntry{{"a/", nil}, {"b/", nil}, {"a/1.jpg", noise(10)}, {"b/2.jpg", noise(10)}, {"3.jpg", noise(10)}}, 0},
+		{"too many entries", []zipEntry{{"1.jpg", noise(10)}, {"2.jpg", noise(10)}, {"3.jpg", noise(10)}, {"4.jpg", noise(10)}}, 413},
+		{"too large in total", []zipEntry{{"a.jpg", noise(600)}, {"b.jpg", noise(600)}}, 413},
+		{"compression bomb", []zipEntry{{"a.jpg", make([]byte, 900)}}, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkZipLimits(buildZip(t, tt.entries...))
+			if got := statusOf(err); got != tt.status || (tt.status == 0 && err != nil) {
+				t.Errorf("checkZipLimits() = %v, want status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestProcessZipEntryLimits(t *testing.T) {
+	saved := MAX_UPLOAD_SIZE
+	MAX_UPLOAD_SIZE = 100
+	defer func() { MAX_UPLOAD_SIZE = saved }()
+
+	archive := buildZip(t, zipEntry{"big.jpg", make([]byte, 200)})
+	if _, err := (&Service{}).processZipEntry(archive.File[0], types.UploadOptions{}); statusOf(err) != 413 {
+		t.Errorf("oversized entry: got %v, want status 413", err)
+	}
+
+	// An entry declaring fewer bytes than it holds is caught while extracting
+	archive = buildZip(t, zipEntry{"liar.jpg", bytes.Repeat([]byte{1}, 50)})
+	archive.File[0].UncompressedSize64 = 10
+	if _, err := (&Service{}).processZipEntry(archive.File[0], types.UploadOptions{}); statusOf(err) != 400 {
+		t.Errorf("lying entry: got %v, want status 400", err)
+	}
+}
+
+func TestSkipZipEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		skip bool
+	}{
+		{"photo.jpg", false},
+		{"holiday/beach.png", false},
+		{"__MACOSX/holiday/._beach.png", true},
+		{"holiday/.DS_Store", true},
+		{".hidden.jpg", true},
+		{"notes.txt", true},
+		{"archive.zip", true},
+	}
+
+	for _, tt := range tests {
+		if got := skipZipEntry(tt.name); got != tt.skip {
+			t.Errorf("skipZipEntry(%q) = %v, want %v", tt.name, got, tt.skip)
+		}
+	}
+}
+
+func TestZipFolder(t *testing.T) {
+	tests := map[string]string{
+		"photo.jpg":                "",
+		"holiday/beach.png":        "holiday",
+		"holiday/2024/beach.png":   "holiday/2024",
+		"../../etc/beach.png":      "etc",
+		"/holiday//./beach.png":    "holiday",
+		"holiday/../work/desk.jpg": "work",
+	}
+
+	for name, want := range tests {
+		if got := zipFolder(name); got != want || strings.Contains(got, "..") {
+			t.Errorf("zipFolder(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -3,12 +3,19 @@ package main
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	memory "github.com/okanay/file-upload-go/cache"
 	"github.com/okanay/file-upload-go/db"
+	"github.com/okanay/file-upload-go/internal/apikey"
 	"github.com/okanay/file-upload-go/internal/asset"
+	authentication "github.com/okanay/file-upload-go/internal/auth"
+	"github.com/okanay/file-upload-go/internal/collection"
+	"github.com/okanay/file-upload-go/internal/tus"
 	"github.com/okanay/file-upload-go/internal/upload"
+	"github.com/okanay/file-upload-go/storage"
 	"log"
-	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -27,56 +34,149 @@ func main() {
 	}
 	defer db.Close(sqlDB)
 
+	// Set Storage Backend
+	store, err := storage.Init(os.Getenv("STORAGE_DRIVER"))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Set Memory Cache
+	cache := memory.Init(true)
+
 	// ->> Middlewares
 	router := gin.Default()
 	router.Use(db.SecureMiddleware)
 	router.Use(db.CorsConfig())
 	router.Use(db.CookieMiddleware())
-	router.Use(db.TimeoutMiddleware(150 * time.Second))
 
-	// ->> Auth Middleware
-	auth := router.Group("auth")
-	auth.Use(db.AuthMiddleware())
+	// Every route but the streamed downloads shares the request timeout
+	api := router.Group("", db.TimeoutMiddleware(150*time.Second))
 
 	// Repositories
+	authRepo := authentication.NewRepository(sqlDB)
+	apiKeyRepo := apikey.NewRepository(sqlDB)
 	uploadRepo := upload.NewRepository(sqlDB)
 	assetRepo := asset.NewRepository(sqlDB)
+	tusRepo := tus.NewRepository(sqlDB)
+	collectionRepo := collection.NewRepository(sqlDB)
 	// Services
-	uploadService := upload.NewService(uploadRepo)
-	assetService := asset.NewService(assetRepo)
+	authService := authentication.NewService(authRepo)
+	apiKeyService := apikey.NewService(apiKeyRepo)
+	uploadService := upload.NewService(uploadRepo, store)
+	assetService := asset.NewService(assetRepo, cache, os.Getenv("URL_SIGNING_KEY"))
+	tusService := tus.NewService(tusRepo, uploadService)
+	collectionService := collection.NewService(collectionRepo)
+	// Derivatives are kept within DERIVATIVE_CACHE_MB of storage
+	derivativeBudget := int64(asset.DefaultDerivativeBudget)
+	if mb, err := strconv.ParseInt(os.Getenv("DERIVATIVE_CACHE_MB"), 10, 64); err == nil && mb > 0 {
+		derivativeBudget = mb << 20
+	}
+
+	// Image processing for derivatives
+	if err := asset.SetImageProcessor(os.Getenv("IMAGE_PROCESSOR")); err != nil {
+		log.Fatal(err)
+	}
+	if workers, err := strconv.Atoi(os.Getenv("IMAGE_WORKERS")); err == nil && workers > 0 {
+		asset.ImageWorkers = workers
+	}
+	if depth, err := strconv.Atoi(os.Getenv("IMAGE_QUEUE_DEPTH")); err == nil && depth >= 0 {
+		asset.ImageQueueDepth = depth
+	}
+
+	// Trashed assets are purged after TRASH_RETENTION_DAYS
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		asset.TrashRetention = time.Duration(days) * 24 * time.Hour
+	}
+
 	// Handlers
+	authHandler := authentication.NewHandler(authService)
+	apiKeyHandler := apikey.NewHandler(apiKeyService)
 	uploadHandler := upload.NewHandler(uploadService)
-	assetHandler := asset.NewAssetHandler(assetService, "./public", "./public/blur", "./public/optimized", true, 60*time.Minute)
+	tusHandler := tus.NewHandler(tusService)
+	collectionHandler := collection.NewHandler(collectionService)
+	assetHandler := asset.NewAssetHandler(assetService, uploadService, store, "blur", "optimized", derivativeBudget, asset.DefaultEvictInterval)
+
+	// Cache-Control per asset kind, e.g. CACHE_CONTROL_OPTIMIZED
+	for kind := range asset.CacheControl {
+		if policy := os.Getenv("CACHE_CONTROL_" + strings.ToUpper(kind)); policy != "" {
+			asset.CacheControl[kind] = policy
+		}
+	}
+
+	// Seed the first account from the environment
+	if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		if err := authService.EnsureUser(username, os.Getenv("ADMIN_PASSWORD")); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	// ->> Auth Middleware
+	auth := api.Group("auth")
+	auth.Use(db.AuthMiddleware(authService, apiKeyService))
+
+	// ->> Download Routes, with their own deadline
+	downloads := router.Group("auth", db.TimeoutMiddleware(asset.DownloadTimeout))
+	downloads.Use(db.AuthMiddleware(authService, apiKeyService))
 
 	// Main Route
-	router.GET("/", func(c *gin.Context) {
+	api.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "Welcome to File Upload API", "Language": "Go Lang", "Framework": "Gin Gonic"})
 	})
 
 	// Assets Route
-	router.GET("/assets/:filename", assetHandler.GetAsset)
-	router.GET("/assets/all", assetHandler.GetAllAssets)
+	api.GET("/assets/:filename", assetHandler.GetAsset)
+	api.HEAD("/assets/:filename", assetHandler.GetAsset)
+	api.GET("/assets/all", assetHandler.GetAllAssets)
 
 	// Auth Routes
-	auth.POST("/upload", uploadHandler.UploadFile)
-	auth.POST("/assets/delete", assetHandler.DeleteAsset)
+	auth.POST("/upload", db.RequireScope(apikey.SCOPE_UPLOAD), uploadHandler.UploadFile)
+	auth.POST("/upload/zip", db.RequireScope(apikey.SCOPE_UPLOAD), uploadHandler.UploadZip)
+	auth.POST("/assets/delete", db.RequireScope(apikey.SCOPE_DELETE), assetHandler.DeleteAsset)
+	auth.PATCH("/assets/:filename", db.RequireScope(apikey.SCOPE_UPLOAD), assetHandler.UpdateAsset)
+	auth.POST("/assets/replace", db.RequireScope(apikey.SCOPE_UPLOAD), assetHandler.ReplaceAsset)
+	auth.GET("/assets/versions", db.RequireScope(apikey.SCOPE_LIST), assetHandler.GetAssetVersions)
+	auth.POST("/assets/revert", db.RequireScope(apikey.SCOPE_UPLOAD), assetHandler.RevertAsset)
+	auth.GET("/assets/trash", db.RequireScope(apikey.SCOPE_LIST), assetHandler.GetTrash)
+	auth.POST("/assets/trash/restore", db.RequireScope(apikey.SCOPE_DELETE), assetHandler.RestoreAsset)
+	auth.POST("/assets/trash/purge", db.RequireScope(apikey.SCOPE_DELETE), assetHandler.PurgeAsset)
+	auth.GET("/assets", db.RequireScope(apikey.SCOPE_LIST), assetHandler.GetAllAssets)
+	auth.GET("/assets/search", db.RequireScope(apikey.SCOPE_LIST), assetHandler.SearchAssets)
+	auth.POST("/assets/sign", db.RequireScope(apikey.SCOPE_LIST), assetHandler.SignAsset)
+	auth.POST("/assets/tags/add", db.RequireScope(apikey.SCOPE_UPLOAD), assetHandler.TagAsset)
+	auth.POST("/assets/tags/remove", db.RequireScope(apikey.SCOPE_UPLOAD), assetHandler.UntagAsset)
+	auth.GET("/tags", db.RequireScope(apikey.SCOPE_LIST), assetHandler.GetTags)
+	downloads.GET("/assets/download", db.RequireScope(apikey.SCOPE_LIST), assetHandler.DownloadAssets)
 
-	// Login Route
-	router.GET("/login", func(c *gin.Context) {
-		sessionToken := os.Getenv("SECRET_SESSION_KEY")
+	// Collection Routes
+	auth.GET("/collections", db.RequireScope(apikey.SCOPE_LIST), collectionHandler.GetCollections)
+	auth.POST("/collections", db.RequireScope(apikey.SCOPE_UPLOAD), collectionHandler.CreateCollection)
+	auth.PATCH("/collections/:id", db.RequireScope(apikey.SCOPE_UPLOAD), collectionHandler.UpdateCollection)
+	auth.POST("/collections/:id/assets/add", db.RequireScope(apikey.SCOPE_UPLOAD), collectionHandler.AddAssets)
+	auth.POST("/collections/:id/assets/remove", db.RequireScope(apikey.SCOPE_UPLOAD), collectionHandler.RemoveAssets)
 
-		c.SetSameSite(http.SameSiteLaxMode)
-		c.SetCookie("session_token", sessionToken, 3600, "/", "", true, true)
+	// Resumable Upload Routes (tus 1.0)
+	tusFiles := auth.Group("/files", db.RequireScope(apikey.SCOPE_UPLOAD))
+	tusFiles.OPTIONS("", tusHandler.Options)
+	tusFiles.POST("", tusHandler.CreateUpload)
+	tusFiles.HEAD("/:id", tusHandler.GetUploadStatus)
+	tusFiles.PATCH("/:id", tusHandler.PatchUpload)
+	tusFiles.DELETE("/:id", tusHandler.TerminateUpload)
 
-		c.JSON(200, gin.H{"message": "Login Successful"})
-	})
+	// Login Route
+	api.POST("/login", authHandler.Login)
 
-	// Logout Route
-	auth.GET("/logout", func(c *gin.Context) {
-		c.SetCookie("session_token", "", -1, "/", "", true, true)
+	// Session Routes
+	auth.GET("/logout", authHandler.Logout)
+	auth.GET("/me", authHandler.Me)
+	auth.GET("/sessions", db.RequireScope(apikey.SCOPE_ADMIN), authHandler.GetSessions)
+	auth.DELETE("/sessions/:id", db.RequireScope(apikey.SCOPE_ADMIN), authHandler.RevokeSession)
 
-		c.JSON(200, gin.H{"message": "Logout Successful"})
-	})
+	// API Key Routes
+	auth.POST("/api-keys", db.RequireScope(apikey.SCOPE_ADMIN), apiKeyHandler.CreateAPIKey)
+	auth.GET("/api-keys", db.RequireScope(apikey.SCOPE_ADMIN), apiKeyHandler.GetAPIKeys)
+	auth.DELETE("/api-keys/:id", db.RequireScope(apikey.SCOPE_ADMIN), apiKeyHandler.RevokeAPIKey)
 
 	// 404 Handler
 	router.NoRoute(func(c *gin.Context) {
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: root}
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	// Write next to the target and rename, readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, info, err
+	}
+
+	target, _ := s.path(key)
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, info, err
+	}
+
+	return file, info, nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	stat, err := os.Stat(target)
+	if os.IsNotExist(err) || (err == nil && stat.IsDir()) {
+		return ObjectInfo{}, ErrNotExist
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	dir, err := s.path(path.Dir(prefix))
+	if err != nil {
+		return objects, err
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, ObjectInfo{
+			Key:          key,
+			Size:         info.Size(),
+			ContentType:  mime.TypeByExtension(path.Ext(key)),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+
+	return objects, err
+}
+
+func (s *LocalStorage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" && key != "" && key != "." {
+		return "", errors.New("invalid storage key: " + key)
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
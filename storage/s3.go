@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+)
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3Storage works with AWS S3 and any S3 compatible server such as MinIO.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("S3_ENDPOINT and S3_BUCKET must be set")
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check s3 bucket: %w", err)
+	}
+
+	if !exists {
+		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create s3 bucket: %w", err)
+		}
+		fmt.Println("[STORAGE] Bucket created:", config.Bucket)
+	}
+
+	return &S3Storage{client: client, bucket: config.Bucket}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, info, err
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, info, s.mapError(err)
+	}
+
+	return object, info, nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	stat, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s.mapError(err)
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         stat.Size,
+		ContentType:  stat.ContentType,
+		LastModified: stat.LastModified,
+	}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	return s.mapError(err)
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return objects, object.Err
+		}
+
+		objects = append(objects, ObjectInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			ContentType:  object.ContentType,
+			LastModified: object.LastModified,
+		})
+	}
+
+	return objects, nil
+}
+
+func (s *S3Storage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+
+	var err error
+	switch {
+	case length > 0:
+		err = opts.SetRange(offset, offset+length-1)
+	case length < 0 && offset > 0:
+		err = opts.SetRange(offset, 0)
+	case length == 0:
+		return io.NopCloser(&io.LimitedReader{}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, opts)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+
+	// GetObject is lazy, a missing key only shows on the first read
+	buffered := bufio.NewReader(object)
+	if _, err := buffered.Peek(1); err != nil && err != io.EOF {
+		object.Close()
+		return nil, s.mapError(err)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{buffered, object}, nil
+}
+
+func (s *S3Storage) mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotExist
+	}
+	return err
+}
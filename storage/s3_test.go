@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The S3 backend is tested against a real server, e.g. a local MinIO:
+//
+//	S3_TEST_ENDPOINT=127.0.0.1:9000 S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin go test ./storage
+func TestS3Storage(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+
+	bucket := os.Getenv("S3_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "file-upload-go-test"
+	}
+
+	s, err := NewS3Storage(S3Config{
+		Endpoint:  endpoint,
+		Region:    os.Getenv("S3_TEST_REGION"),
+		Bucket:    bucket,
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testBackend(t, s, fmt.Sprintf("test-%d/", time.Now().UnixNano()))
+}
+
+func TestLocalStorageBackend(t *testing.T) {
+	testBackend(t, NewLocalStorage(t.TempDir()), "test/")
+}
+
+// testBackend runs the behaviour every Storage must share under prefix and
+// removes what it wrote.
+func testBackend(t *testing.T, s Storage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "a1b2c3d4.jpg"
+	content := "0123456789"
+
+	t.Cleanup(func() {
+		objects, _ := s.List(ctx, prefix)
+		for _, object := range objects {
+			s.Delete(ctx, object.Key)
+		}
+	})
+
+	missing := prefix + "missing.jpg"
+	if _, err := s.Stat(ctx, missing); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat of a missing key: got %v, want ErrNotExist", err)
+	}
+	if _, _, err := s.Get(ctx, missing); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Get of a missing key: got %v, want ErrNotExist", err)
+	}
+	if _, err := s.OpenRange(ctx, missing, 0, 4); !errors.Is(err, ErrNotExist) {
+		t.Errorf("OpenRange of a missing key: got %v, want ErrNotExist", err)
+	}
+	if err := s.Delete(ctx, missing); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+
+	if err := s.Put(ctx, key, strings.NewReader(content), int64(len(content)), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, prefix+"optimized/a1b2c3d4-60.jpg", strings.NewReader("x"), -1, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != key || info.Size != int64(len(content)) || info.ContentType != "image/jpeg" {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	reader, info, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != content || info.Size != int64(len(content)) {
+		t.Errorf("Get = %q, %+v, %v", data, info, err)
+	}
+
+	for _, tt := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 4, "0123"},
+		{3, 4, "3456"},
+		{6, -1, "6789"},
+		{0, -1, content},
+		{2, 0, ""},
+	} {
+		reader, err := s.OpenRange(ctx, key, tt.offset, tt.length)
+		if err != nil {
+			t.Errorf("OpenRange(%d, %d): %v", tt.offset, tt.length, err)
+			continue
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil || string(data) != tt.want {
+			t.Errorf("OpenRange(%d, %d) = %q, %v, want %q", tt.offset, tt.length, data, err, tt.want)
+		}
+	}
+
+	objects, err := s.List(ctx, prefix+"optimized/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != prefix+"optimized/a1b2c3d4-60.jpg" {
+		t.Errorf("List of the optimized folder = %+v", objects)
+	}
+
+	objects, err = s.List(ctx, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = object.Key
+	}
+	slices.Sort(keys)
+	if want := []string{key, prefix + "optimized/a1b2c3d4-60.jpg"}; !slices.Equal(keys, want) {
+		t.Errorf("List = %v, want %v", keys, want)
+	}
+
+	trashed := prefix + TrashDir + "/a1b2c3d4.jpg"
+	if err := Move(ctx, s, key, trashed); err != nil {
+		t.Fatal(err)
+	}
+	if Exists(ctx, s, key) || !Exists(ctx, s, trashed) {
+		t.Error("Move left the object at its old key")
+	}
+	if err := Move(ctx, s, key, trashed); err != nil {
+		t.Errorf("repeating a finished move: %v", err)
+	}
+	if err := Move(ctx, s, missing, trashed+".2"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("moving a missing key: got %v, want ErrNotExist", err)
+	}
+
+	if err := s.Delete(ctx, trashed); err != nil {
+		t.Fatal(err)
+	}
+	if Exists(ctx, s, trashed) {
+		t.Error("Delete left the object")
+	}
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var ErrNotExist = errors.New("object does not exist")
+
+// TrashDir holds the files of trashed assets until they are purged.
+const TrashDir = "trash"
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Storage is implemented by every backend that can hold originals and
+// derivatives. Keys are slash separated paths relative to the storage root,
+// e.g. "2a3f9b97.jpeg" or "optimized/2a3f9b97-40.jpeg".
+type Storage interface {
+	// Put writes the object atomically. Size may be -1 when it is unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// OpenRange reads length bytes starting at offset. A negative length
+	// reads until the end of the object.
+	OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+func Init(driver string) (Storage, error) {
+	switch driver {
+	case "", "local":
+		fmt.Println("[STORAGE] Using local storage")
+		return NewLocalStorage("./public"), nil
+	case "s3":
+		fmt.Println("[STORAGE] Using S3 storage")
+		return NewS3Storage(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			UseSSL:    os.Getenv("S3_USE_SSL") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", driver)
+	}
+}
+
+func Exists(ctx context.Context, s Storage, key string) bool {
+	_, err := s.Stat(ctx, key)
+	return err == nil
+}
+
+// Move copies an object to a new key and deletes the old one. An object that
+// is already at the new key counts as moved, so an interrupted move can be
+// repeated.
+func Move(ctx context.Context, s Storage, from, to string) error {
+	reader, info, err := s.Get(ctx, from)
+	if errors.Is(err, ErrNotExist) && Exists(ctx, s, to) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := s.Put(ctx, to, reader, info.Size, info.ContentType); err != nil {
+		return err
+	}
+	return s.Delete(ctx, from)
+}
+
+// NewReadSeeker exposes an object as an io.ReadSeeker backed by OpenRange,
+// so it can be handed to http.ServeContent without reading it up front.
+func NewReadSeeker(ctx context.Context, s Storage, info ObjectInfo) io.ReadSeekCloser {
+	return &rangeReader{ctx: ctx, storage: s, key: info.Key, size: info.Size}
+}
+
+type rangeReader struct {
+	ctx     context.Context
+	storage Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.storage.OpenRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	var next int64
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = r.offset + offset
+	case io.SeekEnd:
+		next = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if next < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if next != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+
+	r.offset = next
+	return next, nil
+}
+
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
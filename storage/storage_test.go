@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorageKeysStayInRoot(t *testing.T) {
+	root := t.TempDir()
+	s := NewLocalStorage(filepath.Join(root, "files"))
+	ctx := context.Background()
+
+	for _, key := range []string{"../outside.jpg", "../../outside.jpg", "/../outside.jpg"} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, "outside.jpg")); err == nil {
+			t.Fatalf("%s was written outside the storage root", key)
+		}
+	}
+}
+
+func TestMove(t *testing.T) {
+	s := NewLocalStorage(t.TempDir())
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "a1b2c3d4.jpg", strings.NewReader("content"), 7, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Move(ctx, s, "a1b2c3d4.jpg", TrashDir+"/a1b2c3d4.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if Exists(ctx, s, "a1b2c3d4.jpg") {
+		t.Error("the source still exists after the move")
+	}
+
+	reader, _, err := s.Get(ctx, TrashDir+"/a1b2c3d4.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "content" {
+		t.Errorf("moved content is %q", data)
+	}
+
+	// An interrupted move is finished by repeating it
+	if err := Move(ctx, s, "a1b2c3d4.jpg", TrashDir+"/a1b2c3d4.jpg"); err != nil {
+		t.Errorf("repeating a finished move: %v", err)
+	}
+
+	if err := Move(ctx, s, "missing.jpg", TrashDir+"/missing.jpg"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("moving a missing file: got %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,21 @@
+package types
+
+import "time"
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+type CreateAPIKeyReq struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
@@ -1,24 +1,194 @@
 package types
 
+import (
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
 type Assets struct {
-	ID          int    `json:"id"`
-	Creator     string `json:"creator"`
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	Filename    string `json:"filename"`
-	Description string `json:"description"`
-	Size        int64  `json:"size"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
+	ID               int           `json:"id"`
+	Creator          string        `json:"creator"`
+	Name             string        `json:"name"`
+	Type             string        `json:"type"`
+	MimeType         string        `json:"mime_type"`
+	Filename         string        `json:"filename"`
+	OriginalFilename string        `json:"original_filename"`
+	Description      string        `json:"description"`
+	Title            string        `json:"title"`
+	AltText          string        `json:"alt_text"`
+	Size             int64         `json:"size"`
+	Hash             string        `json:"hash"`
+	Visibility       string        `json:"visibility"`
+	Version          int           `json:"version"`
+	Revision         int           `json:"revision"`
+	BlurHash         string        `json:"blur_hash"`
+	ThumbHash        string        `json:"thumb_hash"`
+	Metadata         ImageMetadata `json:"metadata"`
+	Processing       Processing    `json:"processing"`
+	Tags             []string      `json:"tags"`
+	Collections      []int64       `json:"collections"`
+	StorageKey       string        `json:"-"`
+	ArchiveKey       string        `json:"-"`
+	Duplicate        bool          `json:"duplicate,omitempty"`
+	CreatedAt        string        `json:"created_at"`
+	UpdatedAt        string        `json:"updated_at"`
+	DeletedAt        *time.Time    `json:"deleted_at,omitempty"`
+}
+
+// AssetColumns returns the select list matching Assets.ScanFields, shared by
+// every query that returns full asset rows. Assets uploaded before
+// deduplication have no blob and are stored under their filename, in the
+// trash folder while they are trashed; trashParam is the number of the query
+// parameter holding that folder.
+func AssetColumns(trashParam int) string {
+	return `id, creator, name, type, mime_type, filename, COALESCE(original_filename, ''), description, COALESCE(title, ''), COALESCE(alt_text, ''), size,
+	COALESCE(hash, ''), visibility, version, revision,
+	COALESCE(blur_hash, ''), COALESCE(thumb_hash, ''),
+	COALESCE(width, 0), COALESCE(height, 0), COALESCE(orientation, 0), COALESCE(camera_make, ''), COALESCE(camera_model, ''),
+	COALESCE(lens_model, ''), taken_at, COALESCE(exposure_time, ''), COALESCE(f_number, 0), COALESCE(iso, 0),
+	COALESCE(focal_length, 0), gps_latitude, gps_longitude, COALESCE(color_space, ''), COALESCE(dominant_colors, '{}'), metadata,
+	processing, COALESCE(archive_key, ''),
+	ARRAY(SELECT tags.name FROM asset_tags JOIN tags ON tags.id = asset_tags.tag_id WHERE asset_tags.asset_id = assets.id ORDER BY tags.name),
+	ARRAY(SELECT collection_id FROM collection_assets WHERE collection_assets.asset_id = assets.id ORDER BY collection_id),
+	COALESCE((SELECT storage_key FROM blobs WHERE blobs.hash = assets.hash),
+		CASE WHEN deleted_at IS NULL THEN filename ELSE $` + strconv.Itoa(trashParam) + `::text || '/' || filename END),
+	created_at, updated_at, deleted_at`
+}
+
+func (a *Assets) ScanFields() []interface{} {
+	m := &a.Metadata
+	return []interface{}{&a.ID, &a.Creator, &a.Name, &a.Type, &a.MimeType, &a.Filename, &a.OriginalFilename, &a.Description, &a.Title, &a.AltText, &a.Size, &a.Hash, &a.Visibility,
+		&a.Version, &a.Revision, &a.BlurHash, &a.ThumbHash,
+		&m.Width, &m.Height, &m.Orientation, &m.CameraMake, &m.CameraModel, &m.LensModel, &m.TakenAt, &m.ExposureTime, &m.FNumber, &m.ISO,
+		&m.FocalLength, &m.GPSLatitude, &m.GPSLongitude, &m.ColorSpace, pq.Array(&m.DominantColors), &m.EXIF,
+		&a.Processing, &a.ArchiveKey, pq.Array(&a.Tags), pq.Array(&a.Collections), &a.StorageKey, &a.CreatedAt, &a.UpdatedAt, &a.DeletedAt}
+}
+
+// AssetVersion is content an asset had before it was replaced. Versions
+// keep their blob, so they can be viewed and reverted to.
+type AssetVersion struct {
+	Version    int           `json:"version"`
+	Hash       string        `json:"hash"`
+	MimeType   string        `json:"mime_type"`
+	Size       int64         `json:"size"`
+	BlurHash   string        `json:"blur_hash"`
+	ThumbHash  string        `json:"thumb_hash"`
+	Metadata   ImageMetadata `json:"metadata"`
+	Processing Processing    `json:"processing"`
+	ArchiveKey string        `json:"-"`
+	StorageKey string        `json:"-"`
+	ReplacedBy string        `json:"replaced_by"`
+	CreatedAt  string        `json:"created_at"`
+}
+
+// AssetVersionColumns is the select list matching AssetVersion.ScanFields.
+const AssetVersionColumns = `version, hash, mime_type, size, COALESCE(blur_hash, ''), COALESCE(thumb_hash, ''), image_metadata, processing,
+	COALESCE(archive_key, ''), (SELECT storage_key FROM blobs WHERE blobs.hash = asset_versions.hash), replaced_by, created_at`
+
+func (v *AssetVersion) ScanFields() []interface{} {
+	return []interface{}{&v.Version, &v.Hash, &v.MimeType, &v.Size, &v.BlurHash, &v.ThumbHash, &v.Metadata, &v.Processing,
+		&v.ArchiveKey, &v.StorageKey, &v.ReplacedBy, &v.CreatedAt}
 }
 
 type CreateAssetReq struct {
-	Creator     string `json:"creator"`
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	Filename    string `json:"filename"`
-	Description string `json:"description"`
-	Size        int64  `json:"size"`
+	Creator          string        `json:"creator"`
+	Name             string        `json:"name"`
+	Type             string        `json:"type"`
+	MimeType         string        `json:"mime_type"`
+	Filename         string        `json:"filename"`
+	OriginalFilename string        `json:"original_filename"`
+	Description      string        `json:"description"`
+	Size             int64         `json:"size"`
+	Hash             string        `json:"hash"`
+	Visibility       string        `json:"visibility"`
+	BlurHash         string        `json:"blur_hash"`
+	ThumbHash        string        `json:"thumb_hash"`
+	Metadata         ImageMetadata `json:"metadata"`
+	Processing       Processing    `json:"processing"`
+	ArchiveKey       string        `json:"-"`
+	Tags             []string      `json:"tags"`
+	Collection       int           `json:"collection"`
+}
+
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// Dedupe modes for an upload whose content is already stored
+const (
+	DedupeReuse    = "reuse"
+	DedupeExisting = "existing"
+)
+
+// Ingest modes, what happens to the metadata of an upload before it is stored
+const (
+	IngestKeep    = "keep"
+	IngestStrip   = "strip"
+	IngestArchive = "archive"
+)
+
+// Processing steps recorded on an asset
+const (
+	StepAutoOrient      = "auto-orient"
+	StepStripMetadata   = "strip-metadata"
+	StepArchiveOriginal = "archive-original"
+)
+
+type UploadOptions struct {
+	Creator     string   `json:"creator"`
+	Description string   `json:"description"`
+	Dedupe      string   `json:"dedupe"`
+	Visibility  string   `json:"visibility"`
+	Ingest      string   `json:"ingest"`
+	Tags        []string `json:"tags"`
+	Collection  int      `json:"collection"`
+}
+
+// Outcome of one file in a batch upload
+const (
+	UploadCreated    = "created"
+	UploadFailed     = "failed"
+	UploadRolledBack = "rolled_back"
+	UploadSkipped    = "skipped"
+)
+
+type UploadResult struct {
+	File   string  `json:"file"`
+	Status string  `json:"status"`
+	Asset  *Assets `json:"asset,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// UpdateAssetReq holds the editable fields of an asset, nil fields are left
+// unchanged.
+type UpdateAssetReq struct {
+	Name        *string `json:"name"`
+	Creator     *string `json:"creator"`
+	Description *string `json:"description"`
+	Title       *string `json:"title"`
+	AltText     *string `json:"alt_text"`
+}
+
+// SearchResult is an asset matching a search with its rank and the matching
+// parts of its text, keyed by field, with matches wrapped in <mark>.
+type SearchResult struct {
+	Asset      Assets            `json:"asset"`
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`
+	Total      int            `json:"total"`
+	NextOffset int            `json:"next_offset,omitempty"`
+}
+
+type SignAssetReq struct {
+	Filename  string            `json:"filename" binding:"required"`
+	ExpiresIn int               `json:"expires_in"`
+	Params    map[string]string `json:"params"`
 }
 
 type UploadAssetReq struct {
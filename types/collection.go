@@ -0,0 +1,30 @@
+package types
+
+type Collection struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Creator     string `json:"creator"`
+	AssetCount  int    `json:"asset_count"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+type CreateCollectionReq struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+type UpdateCollectionReq struct {
+	Name        string  `json:"name" binding:"required"`
+	Description *string `json:"description"`
+}
+
+type CollectionAssetsReq struct {
+	Filenames []string `json:"filenames" binding:"required"`
+}
+
+type Tag struct {
+	Name       string `json:"name"`
+	AssetCount int    `json:"asset_count"`
+}
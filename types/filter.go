@@ -0,0 +1,38 @@
+package types
+
+import "time"
+
+type AssetFilter struct {
+	Type          string     `json:"type"`
+	Creator       string     `json:"creator"`
+	CreatedAfter  *time.Time `json:"created_after"`
+	CreatedBefore *time.Time `json:"created_before"`
+	MinSize       *int64     `json:"min_size"`
+	MaxSize       *int64     `json:"max_size"`
+	Description   string     `json:"description"`
+	Visibility    string     `json:"visibility"`
+	MinWidth      *int       `json:"min_width"`
+	MaxWidth      *int       `json:"max_width"`
+	MinHeight     *int       `json:"min_height"`
+	MaxHeight     *int       `json:"max_height"`
+	Orientation   string     `json:"orientation"`
+	CameraMake    string     `json:"camera_make"`
+	CameraModel   string     `json:"camera_model"`
+	TakenAfter    *time.Time `json:"taken_after"`
+	TakenBefore   *time.Time `json:"taken_before"`
+	HasGPS        *bool      `json:"has_gps"`
+	ColorSpace    string     `json:"color_space"`
+	Tags          []string   `json:"tags"`
+	Collection    *int       `json:"collection"`
+	Trashed       bool       `json:"trashed"`
+	Sort          string     `json:"sort"`
+	Order         string     `json:"order"`
+	Cursor        string     `json:"cursor"`
+	Limit         int        `json:"limit"`
+}
+
+type AssetPage struct {
+	Assets     []Assets `json:"assets"`
+	NextCursor string   `json:"next_cursor"`
+	Total      int      `json:"total"`
+}
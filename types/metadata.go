@@ -0,0 +1,99 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ImageMetadata is what is known about the pixels of an asset. Width and
+// height are as displayed, after the EXIF orientation is applied.
+type ImageMetadata struct {
+	Width          int        `json:"width"`
+	Height         int        `json:"height"`
+	Orientation    int        `json:"orientation,omitempty"`
+	CameraMake     string     `json:"camera_make,omitempty"`
+	CameraModel    string     `json:"camera_model,omitempty"`
+	LensModel      string     `json:"lens_model,omitempty"`
+	TakenAt        *time.Time `json:"taken_at,omitempty"`
+	ExposureTime   string     `json:"exposure_time,omitempty"`
+	FNumber        float64    `json:"f_number,omitempty"`
+	ISO            int        `json:"iso,omitempty"`
+	FocalLength    float64    `json:"focal_length,omitempty"`
+	GPSLatitude    *float64   `json:"gps_latitude,omitempty"`
+	GPSLongitude   *float64   `json:"gps_longitude,omitempty"`
+	ColorSpace     string     `json:"color_space,omitempty"`
+	DominantColors []string   `json:"dominant_colors,omitempty"`
+	EXIF           JSONMap    `json:"exif,omitempty"`
+}
+
+// Value stores the whole metadata as one JSONB value, used for asset
+// versions. Assets keep it in columns.
+func (m ImageMetadata) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+func (m *ImageMetadata) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		*m = ImageMetadata{}
+		return nil
+	case []byte:
+		return json.Unmarshal(data, m)
+	case string:
+		return json.Unmarshal([]byte(data), m)
+	default:
+		return fmt.Errorf("cannot scan %T into ImageMetadata", src)
+	}
+}
+
+// JSONMap is a JSONB column.
+type JSONMap map[string]interface{}
+
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+func (m *JSONMap) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, m)
+	case string:
+		return json.Unmarshal([]byte(data), m)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONMap", src)
+	}
+}
+
+// Processing records what the ingest step did to an uploaded file before it
+// was stored.
+type Processing struct {
+	Mode     string   `json:"mode"`
+	Steps    []string `json:"steps,omitempty"`
+	Archived bool     `json:"archived,omitempty"`
+}
+
+func (p Processing) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *Processing) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		*p = Processing{}
+		return nil
+	case []byte:
+		return json.Unmarshal(data, p)
+	case string:
+		return json.Unmarshal([]byte(data), p)
+	default:
+		return fmt.Errorf("cannot scan %T into Processing", src)
+	}
+}
@@ -0,0 +1,27 @@
+package types
+
+import "time"
+
+type TusUpload struct {
+	ID            string    `json:"id"`
+	Creator       string    `json:"creator"`
+	Filename      string    `json:"filename"`
+	Description   string    `json:"description"`
+	Metadata      string    `json:"metadata"`
+	Length        int64     `json:"length"`
+	Offset        int64     `json:"offset"`
+	AssetFilename string    `json:"asset_filename"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     string    `json:"created_at"`
+	UpdatedAt     string    `json:"updated_at"`
+}
+
+type CreateTusUploadReq struct {
+	ID          string    `json:"id"`
+	Creator     string    `json:"creator"`
+	Filename    string    `json:"filename"`
+	Description string    `json:"description"`
+	Metadata    string    `json:"metadata"`
+	Length      int64     `json:"length"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
@@ -0,0 +1,33 @@
+package types
+
+import "time"
+
+type User struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type Session struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	UserAgent string     `json:"user_agent"`
+	IPAddress string     `json:"ip_address"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt string     `json:"created_at"`
+}
+
+type CreateSessionReq struct {
+	UserID    int       `json:"user_id"`
+	TokenHash string    `json:"token_hash"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type LoginReq struct {
+	Username string `json:"username" form:"username" binding:"required"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
@@ -0,0 +1,212 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// segments are the metadata blocks found in an image file.
+type segments struct {
+	exif []byte
+	icc  []byte
+	srgb bool
+}
+
+const maxSegmentSize = 16 << 20
+
+// readSegments walks the container of a JPEG, PNG or WebP file and collects
+// its EXIF and ICC profile without decoding any pixels.
+func readSegments(r io.Reader) (segments, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header[:4]); err != nil {
+		return segments{}, err
+	}
+
+	switch {
+	case header[0] == 0xFF && header[1] == 0xD8:
+		return readJPEG(io.MultiReader(bytes.NewReader(header[2:4]), r))
+	case bytes.Equal(header[:4], []byte("\x89PNG")):
+		if _, err := io.ReadFull(r, header[4:8]); err != nil {
+			return segments{}, err
+		}
+		return readPNG(r)
+	case bytes.Equal(header[:4], []byte("RIFF")):
+		if _, err := io.ReadFull(r, header[4:12]); err != nil {
+			return segments{}, err
+		}
+		if string(header[8:12]) != "WEBP" {
+			return segments{}, errors.New("not a WebP file")
+		}
+		return readWebP(r)
+	}
+
+	return segments{}, errors.New("unsupported image container")
+}
+
+func readJPEG(reader io.Reader) (segments, error) {
+	var found segments
+	var iccChunks [][]byte
+
+	r := bufio.NewReader(reader)
+	size := make([]byte, 2)
+	for {
+		marker, err := readJPEGMarker(r)
+		if err != nil {
+			return found, err
+		}
+
+		// Metadata always precedes the scan data
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+
+		if _, err := io.ReadFull(r, size); err != nil {
+			return found, err
+		}
+		length := int(binary.BigEndian.Uint16(size)) - 2
+		if length < 0 {
+			return found, errors.New("invalid JPEG segment length")
+		}
+
+		if marker != 0xE1 && marker != 0xE2 {
+			if err := skip(r, length); err != nil {
+				return found, err
+			}
+			continue
+		}
+
+		data, err := readN(r, length)
+		if err != nil {
+			return found, err
+		}
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(data, []byte("Exif\x00\x00")) && found.exif == nil:
+			found.exif = data[6:]
+		case marker == 0xE2 && bytes.HasPrefix(data, []byte("ICC_PROFILE\x00")) && len(data) > 14:
+			// Profiles larger than a segment are split into numbered chunks
+			iccChunks = append(iccChunks, data[14:])
+		}
+	}
+
+	if len(iccChunks) > 0 {
+		found.icc = bytes.Join(iccChunks, nil)
+	}
+	return found, nil
+}
+
+func readPNG(r io.Reader) (segments, error) {
+	var found segments
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return found, err
+		}
+		length := int(binary.BigEndian.Uint32(header[:4]))
+		chunk := string(header[4:8])
+
+		if chunk == "IDAT" || chunk == "IEND" {
+			break
+		}
+
+		if chunk != "eXIf" && chunk != "sRGB" && chunk != "iCCP" {
+			if err := skip(r, length+4); err != nil {
+				return found, err
+			}
+			continue
+		}
+
+		data, err := readN(r, length+4) // chunk data and CRC
+		if err != nil {
+			return found, err
+		}
+		data = data[:length]
+
+		switch chunk {
+		case "eXIf":
+			found.exif = data
+		case "sRGB":
+			found.srgb = true
+		case "iCCP":
+			// Profile name, a null separator, the compression method and zlib data
+			separator := bytes.IndexByte(data, 0)
+			if separator < 0 || separator+2 > len(data) {
+				continue
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(data[separator+2:]))
+			if err != nil {
+				continue
+			}
+			found.icc, _ = io.ReadAll(io.LimitReader(reader, maxSegmentSize))
+			reader.Close()
+		}
+	}
+
+	return found, nil
+}
+
+func readWebP(r io.Reader) (segments, error) {
+	var found segments
+
+	header := make([]byte, 8)
+	for first := true; ; first = false {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return found, err
+		}
+		chunk := string(header[:4])
+		length := int(binary.LittleEndian.Uint32(header[4:]))
+		padded := length + length%2 // chunks are padded to an even size
+
+		// Only the extended format (VP8X) carries metadata, which may follow
+		// the image data
+		if first && chunk != "VP8X" {
+			return found, nil
+		}
+
+		if chunk != "EXIF" && chunk != "ICCP" {
+			if err := skip(r, padded); err != nil {
+				return found, err
+			}
+			continue
+		}
+
+		data, err := readN(r, padded)
+		if err != nil {
+			return found, err
+		}
+		data = data[:length]
+
+		if chunk == "EXIF" {
+			found.exif = bytes.TrimPrefix(data, []byte("Exif\x00\x00"))
+		} else {
+			found.icc = data
+		}
+	}
+
+	return found, nil
+}
+
+func skip(r io.Reader, n int) error {
+	_, err := io.CopyN(io.Discard, r, int64(n))
+	return err
+}
+
+func readN(r io.Reader, n int) ([]byte, error) {
+	if n > maxSegmentSize {
+		return nil, errors.New("metadata segment too large")
+	}
+	data := make([]byte, n)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
@@ -0,0 +1,49 @@
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"github.com/disintegration/imaging"
+	"image"
+	"io"
+)
+
+// MaxPixels is the largest image, in width times height, that is ever fully
+// decoded. A small file can declare a canvas that takes gigabytes to decode.
+var MaxPixels int64 = 50_000_000
+
+var ErrTooManyPixels = errors.New("image dimensions exceed the pixel limit")
+
+// Decode decodes an image after checking the dimensions in its header
+// against MaxPixels. Every decode of user content goes through here.
+func Decode(r io.Reader, opts ...imaging.DecodeOption) (image.Image, error) {
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, err
+	}
+	if tooManyPixels(config) {
+		return nil, ErrTooManyPixels
+	}
+
+	return imaging.Decode(io.MultiReader(&header, r), opts...)
+}
+
+// CheckPixels fails with ErrTooManyPixels when the header of an image
+// declares more than MaxPixels. Files whose header can't be read pass, they
+// fail when decoded. The reader is rewound either way.
+func CheckPixels(r io.ReadSeeker) error {
+	config, _, configErr := image.DecodeConfig(r)
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if configErr == nil && tooManyPixels(config) {
+		return ErrTooManyPixels
+	}
+	return nil
+}
+
+func tooManyPixels(config image.Config) bool {
+	return int64(config.Width)*int64(config.Height) > MaxPixels
+}
@@ -0,0 +1,60 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// hugePNG is a valid PNG header declaring a canvas of the given size, a few
+// bytes that would take gigabytes to decode.
+func hugePNG(width, height uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 6 // 8-bit RGBA
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestDecodeRejectsHugeCanvas(t *testing.T) {
+	data := hugePNG(60000, 60000)
+
+	if _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("Decode: got %v, want ErrTooManyPixels", err)
+	}
+
+	reader := bytes.NewReader(data)
+	if err := CheckPixels(reader); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("CheckPixels: got %v, want ErrTooManyPixels", err)
+	}
+	if reader.Len() != len(data) {
+		t.Error("CheckPixels did not rewind the reader")
+	}
+}
+
+func TestDecodeWithinBudget(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 40 || bounds.Dy() != 30 {
+		t.Errorf("decoded %v, want 40x30", bounds)
+	}
+}
@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// iccDescription returns the profile description ('desc' tag) of an ICC
+// profile, like "sRGB IEC61966-2.1" or "Display P3". Both the version 2
+// textDescriptionType and the version 4 multiLocalizedUnicodeType are read.
+func iccDescription(profile []byte) string {
+	if len(profile) < 132 {
+		return ""
+	}
+
+	count := int(binary.BigEndian.Uint32(profile[128:132]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(profile) {
+			return ""
+		}
+		if string(profile[entry:entry+4]) != "desc" {
+			continue
+		}
+
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset < 0 || size < 12 || offset+size > len(profile) {
+			return ""
+		}
+		return decodeDescription(profile[offset : offset+size])
+	}
+
+	return iccColorSpace(profile)
+}
+
+func decodeDescription(tag []byte) string {
+	switch string(tag[:4]) {
+	case "desc":
+		length := int(binary.BigEndian.Uint32(tag[8:12]))
+		if length <= 0 || 12+length > len(tag) {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+length]), "\x00 ")
+	case "mluc":
+		if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:12]) == 0 {
+			return ""
+		}
+		// The first record is used, whatever its language
+		length := int(binary.BigEndian.Uint32(tag[20:24]))
+		offset := int(binary.BigEndian.Uint32(tag[24:28]))
+		if offset+length > len(tag) || length%2 != 0 {
+			return ""
+		}
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(tag[offset+i*2:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00 ")
+	}
+	return ""
+}
+
+// iccColorSpace names the data color space of a profile without a
+// description.
+func iccColorSpace(profile []byte) string {
+	switch string(profile[16:20]) {
+	case "RGB ":
+		return "RGB"
+	case "CMYK":
+		return "CMYK"
+	case "GRAY":
+		return "Gray"
+	}
+	return ""
+}
@@ -0,0 +1,231 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/disintegration/imaging"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+	_ "golang.org/x/image/webp"
+	"image"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DominantColorCount is how many colors are kept in DominantColors.
+const DominantColorCount = 5
+
+// maxTagLength keeps long binary tags out of the EXIF JSON.
+const maxTagLength = 256
+
+// skippedTags are EXIF fields that are binary blobs or only describe the
+// EXIF structure itself.
+var skippedTags = map[exif.FieldName]bool{
+	exif.MakerNote:                        true,
+	exif.UserComment:                      true,
+	exif.ThumbJPEGInterchangeFormat:       true,
+	exif.ThumbJPEGInterchangeFormatLength: true,
+	exif.ExifIFDPointer:                   true,
+	exif.GPSInfoIFDPointer:                true,
+	exif.InteroperabilityIFDPointer:       true,
+}
+
+// Extract reads the metadata of an image file and decodes it. The decoded
+// image has its EXIF orientation applied and is returned so callers can
+// reuse it instead of decoding the file again.
+func Extract(r io.ReadSeeker) (types.ImageMetadata, image.Image, error) {
+	var meta types.ImageMetadata
+
+	// A damaged container still gives whatever was read before the damage
+	found, _ := readSegments(r)
+	applyEXIF(&meta, found.exif)
+	applyColorSpace(&meta, found)
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return meta, nil, err
+	}
+
+	img, err := Decode(r)
+	if err != nil {
+		return meta, nil, err
+	}
+	img = Orient(img, meta.Orientation)
+
+	bounds := img.Bounds()
+	meta.Width, meta.Height = bounds.Dx(), bounds.Dy()
+	meta.DominantColors = DominantColors(img, DominantColorCount)
+
+	return meta, img, nil
+}
+
+func applyEXIF(meta *types.ImageMetadata, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if x == nil {
+		return
+	}
+	if err != nil && exif.IsCriticalError(err) {
+		return
+	}
+
+	meta.Orientation = tagInt(x, exif.Orientation)
+	meta.CameraMake = tagString(x, exif.Make)
+	meta.CameraModel = tagString(x, exif.Model)
+	meta.LensModel = tagString(x, exif.LensModel)
+	meta.ISO = tagInt(x, exif.ISOSpeedRatings)
+	meta.FNumber = tagFloat(x, exif.FNumber)
+	meta.FocalLength = tagFloat(x, exif.FocalLength)
+
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && num > 0 && den > 0 {
+			if num == 1 || num >= den {
+				meta.ExposureTime = fmt.Sprintf("%d/%d", num, den)
+			} else {
+				meta.ExposureTime = fmt.Sprintf("1/%d", den/num)
+			}
+		}
+	}
+
+	if taken, err := x.DateTime(); err == nil {
+		meta.TakenAt = &taken
+	}
+
+	if lat, long, err := x.LatLong(); err == nil {
+		meta.GPSLatitude, meta.GPSLongitude = &lat, &long
+	}
+
+	switch tagInt(x, exif.ColorSpace) {
+	case 1:
+		meta.ColorSpace = "sRGB"
+	case 0xFFFF:
+		meta.ColorSpace = "Uncalibrated"
+	}
+
+	meta.EXIF = types.JSONMap{}
+	_ = x.Walk(walkFunc(func(name exif.FieldName, tag *tiff.Tag) error {
+		if skippedTags[name] {
+			return nil
+		}
+
+		var value string
+		if tag.Format() == tiff.StringVal {
+			value, _ = tag.StringVal()
+		} else {
+			value = tag.String()
+		}
+
+		value = strings.TrimSpace(strings.Trim(value, "\x00"))
+		if value != "" && len(value) <= maxTagLength {
+			meta.EXIF[string(name)] = value
+		}
+		return nil
+	}))
+}
+
+// applyColorSpace prefers the name of an embedded ICC profile over what
+// EXIF or the PNG sRGB chunk say.
+func applyColorSpace(meta *types.ImageMetadata, found segments) {
+	if name := iccDescription(found.icc); name != "" {
+		meta.ColorSpace = name
+		return
+	}
+	if meta.ColorSpace == "" && found.srgb {
+		meta.ColorSpace = "sRGB"
+	}
+}
+
+type walkFunc func(exif.FieldName, *tiff.Tag) error
+
+func (f walkFunc) Walk(name exif.FieldName, tag *tiff.Tag) error {
+	return f(name, tag)
+}
+
+func tagString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.Trim(value, "\x00"))
+}
+
+func tagInt(x *exif.Exif, name exif.FieldName) int {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	value, err := tag.Int(0)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func tagFloat(x *exif.Exif, name exif.FieldName) float64 {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+// DominantColors returns up to n hex colors that cover most of the image,
+// most common first. Pixels are grouped at 4 bits per channel on a
+// downscaled copy; mostly transparent pixels are ignored.
+func DominantColors(img image.Image, n int) []string {
+	small := imaging.Fit(img, 64, 64, imaging.Box)
+
+	type bucket struct {
+		key     int
+		count   int
+		r, g, b int
+	}
+	buckets := map[int]*bucket{}
+
+	for i := 0; i < len(small.Pix); i += 4 {
+		if small.Pix[i+3] < 128 {
+			continue
+		}
+		r, g, b := int(small.Pix[i]), int(small.Pix[i+1]), int(small.Pix[i+2])
+		key := r>>4<<8 | g>>4<<4 | b>>4
+
+		entry, ok := buckets[key]
+		if !ok {
+			entry = &bucket{key: key}
+			buckets[key] = entry
+		}
+		entry.count++
+		entry.r += r
+		entry.g += g
+		entry.b += b
+	}
+
+	ranked := make([]*bucket, 0, len(buckets))
+	for _, entry := range buckets {
+		ranked = append(ranked, entry)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].count != ranked[j].count {
+			return ranked[i].count > ranked[j].count
+		}
+		return ranked[i].key < ranked[j].key
+	})
+
+	colors := make([]string, 0, n)
+	for _, entry := range ranked[:min(n, len(ranked))] {
+		colors = append(colors, fmt.Sprintf("#%02x%02x%02x", entry.r/entry.count, entry.g/entry.count, entry.b/entry.count))
+	}
+	return colors
+}
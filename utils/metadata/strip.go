@@ -0,0 +1,497 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"github.com/disintegration/imaging"
+	"github.com/okanay/file-upload-go/types"
+	"github.com/rwcarlsen/goexif/exif"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// piiTags are EXIF fields that identify a person or a device, removed from
+// the stored metadata together with every GPS field.
+var piiTags = []string{
+	"Artist", "XPAuthor", "XPComment", "ImageUniqueID", "UserComment",
+	"CameraOwnerName", "BodySerialNumber", "LensSerialNumber", "SerialNumber",
+}
+
+// RemovePII drops location and personal fields from extracted metadata, to
+// match a file that went through Strip.
+func RemovePII(meta *types.ImageMetadata) {
+	meta.GPSLatitude, meta.GPSLongitude = nil, nil
+
+	for key := range meta.EXIF {
+		if strings.HasPrefix(key, "GPS") {
+			delete(meta.EXIF, key)
+		}
+	}
+	for _, key := range piiTags {
+		delete(meta.EXIF, key)
+	}
+}
+
+// Strip copies a JPEG, PNG or WebP image without its EXIF, XMP, IPTC and
+// text metadata. Pixels and the ICC color profile are copied byte for byte.
+// An orientation above 1 is written back as an EXIF block holding only the
+// orientation, for images whose pixels can't be rotated here.
+func Strip(r io.Reader, w io.Writer, orientation int) error {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		return stripJPEG(br, w, orientation)
+	case bytes.Equal(magic, []byte("\x89PNG")):
+		return stripPNG(br, w, orientation)
+	case bytes.Equal(magic, []byte("RIFF")):
+		return stripWebP(br, w, orientation)
+	}
+
+	return errors.New("unsupported image container")
+}
+
+// stripJPEG copies a JPEG up to its first EOI. Anything after it is dropped,
+// which includes the secondary images of Multi-Picture files from phones
+// that carry their own EXIF and location.
+func stripJPEG(r *bufio.Reader, w io.Writer, orientation int) error {
+	bw := bufio.NewWriter(w)
+
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil {
+		return err
+	}
+	bw.Write(soi)
+
+	if orientation > 1 {
+		if err := writeJPEGSegment(bw, 0xE1, append([]byte("Exif\x00\x00"), orientationEXIF(orientation)...)); err != nil {
+			return err
+		}
+	}
+
+	scanned := false
+	for {
+		marker, err := readJPEGMarker(r)
+		if errors.Is(err, io.EOF) && scanned {
+			return bw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case marker == 0xD9: // EOI
+			bw.Write([]byte{0xFF, marker})
+			return bw.Flush()
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // no length
+			bw.Write([]byte{0xFF, marker})
+			continue
+		}
+
+		size := make([]byte, 2)
+		if _, err := io.ReadFull(r, size); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(size)) - 2
+		if length < 0 {
+			return errors.New("invalid JPEG segment length")
+		}
+
+		data, err := readN(r, length)
+		if err != nil {
+			return err
+		}
+
+		if keepJPEGSegment(marker, data) {
+			bw.Write([]byte{0xFF, marker})
+			bw.Write(size)
+			bw.Write(data)
+		}
+
+		// Progressive images have several scans with tables in between
+		if marker == 0xDA {
+			if err := copyJPEGScan(r, bw); err != nil {
+				return err
+			}
+			scanned = true
+		}
+	}
+}
+
+// readJPEGMarker reads the next marker, skipping the 0xFF fill bytes that
+// may pad the space between segments.
+func readJPEGMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, errors.New("invalid JPEG marker")
+	}
+
+	for b == 0xFF {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+// copyJPEGScan copies entropy coded data up to the next marker, which is
+// left unread. Stuffed zero bytes and restart markers belong to the data.
+// A file that ends inside the data is kept as far as it goes.
+func copyJPEGScan(r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		pair, err := r.Peek(2)
+		if len(pair) < 2 {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		switch {
+		case pair[0] != 0xFF:
+			w.WriteByte(pair[0])
+			r.Discard(1)
+		case pair[1] == 0x00 || (pair[1] >= 0xD0 && pair[1] <= 0xD7):
+			w.Write(pair)
+			r.Discard(2)
+		case pair[1] == 0xFF:
+			// Fill byte, the following 0xFF is looked at again
+			r.Discard(1)
+		default:
+			return nil
+		}
+	}
+}
+
+// keepJPEGSegment keeps every segment that is needed to decode the image,
+// the JFIF and Adobe headers and the ICC profile. Other application
+// segments (EXIF, XMP, IPTC) and comments are dropped.
+func keepJPEGSegment(marker byte, data []byte) bool {
+	switch {
+	case marker == 0xFE:
+		return false
+	case marker == 0xE0:
+		return bytes.HasPrefix(data, []byte("JFIF\x00")) || bytes.HasPrefix(data, []byte("JFXX\x00"))
+	case marker == 0xE2:
+		return bytes.HasPrefix(data, []byte("ICC_PROFILE\x00"))
+	case marker == 0xEE:
+		return bytes.HasPrefix(data, []byte("Adobe"))
+	case marker >= 0xE1 && marker <= 0xEF:
+		return false
+	}
+	return true
+}
+
+func writeJPEGSegment(w io.Writer, marker byte, data []byte) error {
+	header := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(data)+2))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// droppedPNGChunks hold EXIF or free text, which is where PNG writers put
+// XMP, comments, authors and timestamps.
+var droppedPNGChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+func stripPNG(r io.Reader, w io.Writer, orientation int) error {
+	signature := make([]byte, 8)
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return err
+	}
+	if _, err := w.Write(signature); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	wroteOrientation := orientation <= 1
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		chunk := string(header[4:8])
+
+		if chunk == "IDAT" && !wroteOrientation {
+			if err := writePNGChunk(w, "eXIf", orientationEXIF(orientation)); err != nil {
+				return err
+			}
+			wroteOrientation = true
+		}
+
+		if droppedPNGChunks[chunk] {
+			if err := skip(r, int(length+4)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, length+4); err != nil {
+			return err
+		}
+
+		if chunk == "IEND" {
+			return nil
+		}
+	}
+}
+
+func writePNGChunk(w io.Writer, chunk string, data []byte) error {
+	buf := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(data)))
+	copy(buf[4:8], chunk)
+	buf = append(buf, data...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// VP8X flags for the optional chunks that are removed
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func stripWebP(r io.Reader, w io.Writer, orientation int) error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if string(header[8:12]) != "WEBP" {
+		return errors.New("not a WebP file")
+	}
+
+	// The RIFF size changes with the removed chunks, so the body is rebuilt
+	// in memory before it is written
+	var body bytes.Buffer
+	vp8x := -1 // offset of the VP8X flags in body
+
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		chunk := string(chunkHeader[:4])
+		length := int(binary.LittleEndian.Uint32(chunkHeader[4:]))
+		padded := int64(length + length%2)
+
+		if chunk == "EXIF" || chunk == "XMP " {
+			if err := skip(r, int(padded)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		offset := body.Len()
+		body.Write(chunkHeader)
+		if _, err := io.CopyN(&body, r, padded); err != nil {
+			return err
+		}
+		if chunk == "VP8X" && length > 0 {
+			vp8x = offset + 8
+		}
+	}
+
+	if vp8x >= 0 {
+		body.Bytes()[vp8x] &^= webpFlagEXIF | webpFlagXMP
+		if orientation > 1 {
+			body.Bytes()[vp8x] |= webpFlagEXIF
+			exifData := orientationEXIF(orientation)
+			chunkHeader := make([]byte, 8)
+			copy(chunkHeader, "EXIF")
+			binary.LittleEndian.PutUint32(chunkHeader[4:], uint32(len(exifData)))
+			body.Write(chunkHeader)
+			body.Write(exifData)
+			if len(exifData)%2 == 1 {
+				body.WriteByte(0)
+			}
+		}
+	}
+
+	binary.LittleEndian.PutUint32(header[4:8], uint32(4+body.Len()))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := body.WriteTo(w)
+	return err
+}
+
+// orientationEXIF is a big-endian TIFF structure with a single IFD entry,
+// the Orientation tag.
+func orientationEXIF(orientation int) []byte {
+	data := []byte("MM\x00\x2A\x00\x00\x00\x08")
+	data = binary.BigEndian.AppendUint16(data, 1)      // entry count
+	data = binary.BigEndian.AppendUint16(data, 0x0112) // Orientation
+	data = binary.BigEndian.AppendUint16(data, 3)      // SHORT
+	data = binary.BigEndian.AppendUint32(data, 1)      // value count
+	data = binary.BigEndian.AppendUint16(data, uint16(orientation))
+	data = binary.BigEndian.AppendUint16(data, 0) // padding
+	data = binary.BigEndian.AppendUint32(data, 0) // no next IFD
+	return data
+}
+
+// Orientation reads the EXIF orientation of an image without decoding its
+// pixels. Images without one are upright, which is reported as 1.
+func Orientation(r io.Reader) int {
+	found, _ := readSegments(r)
+	return exifOrientation(found.exif)
+}
+
+func exifOrientation(data []byte) int {
+	if len(data) == 0 {
+		return 1
+	}
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if x == nil || (err != nil && exif.IsCriticalError(err)) {
+		return 1
+	}
+	if orientation := tagInt(x, exif.Orientation); orientation >= 1 && orientation <= 8 {
+		return orientation
+	}
+	return 1
+}
+
+// Orient applies an EXIF orientation to the pixels of img. imaging only
+// reads the orientation of JPEG files, this works for any format.
+func Orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// CanAutoOrient reports whether AutoOrient can re-encode the format of ext.
+func CanAutoOrient(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// AutoOrient re-encodes a JPEG or PNG with its EXIF orientation applied to
+// the pixels. The result has no metadata except the original ICC profile.
+// JPEGs are written at the given quality, PNGs stay lossless.
+func AutoOrient(r io.ReadSeeker, w io.Writer, ext string, quality int) error {
+	found, _ := readSegments(r)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	orientation := exifOrientation(found.exif)
+
+	img, err := Decode(r)
+	if err != nil {
+		return err
+	}
+	img = Orient(img, orientation)
+
+	var encoded bytes.Buffer
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		err = imaging.Encode(&encoded, img, imaging.JPEG, imaging.JPEGQuality(quality))
+	case ".png":
+		err = png.Encode(&encoded, img)
+	default:
+		return errors.New("auto orientation is not supported for " + ext)
+	}
+	if err != nil {
+		return err
+	}
+
+	data := encoded.Bytes()
+	if len(found.icc) == 0 {
+		_, err = w.Write(data)
+		return err
+	}
+
+	if strings.ToLower(ext) == ".png" {
+		return embedPNGProfile(w, data, found.icc)
+	}
+	return embedJPEGProfile(w, data, found.icc)
+}
+
+// maxICCChunk is the profile data that fits in one APP2 segment next to the
+// "ICC_PROFILE" header and the chunk numbers.
+const maxICCChunk = 65535 - 2 - 14
+
+func embedJPEGProfile(w io.Writer, data, icc []byte) error {
+	if _, err := w.Write(data[:2]); err != nil {
+		return err
+	}
+
+	count := (len(icc) + maxICCChunk - 1) / maxICCChunk
+	if count > 255 {
+		return errors.New("ICC profile too large")
+	}
+	for i := 0; i < count; i++ {
+		chunk := icc[i*maxICCChunk : min((i+1)*maxICCChunk, len(icc))]
+		segment := append([]byte("ICC_PROFILE\x00"), byte(i+1), byte(count))
+		if err := writeJPEGSegment(w, 0xE2, append(segment, chunk...)); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(data[2:])
+	return err
+}
+
+func embedPNGProfile(w io.Writer, data, icc []byte) error {
+	// The signature and the IHDR chunk come first
+	ihdrEnd := 8 + 8 + int(binary.BigEndian.Uint32(data[8:12])) + 4
+	if _, err := w.Write(data[:ihdrEnd]); err != nil {
+		return err
+	}
+
+	var compressed bytes.Buffer
+	compressed.WriteString("ICC Profile\x00\x00")
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(icc); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if err := writePNGChunk(w, "iCCP", compressed.Bytes()); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data[ihdrEnd:])
+	return err
+}
@@ -0,0 +1,204 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+const secret = "GPS 52.5200N 13.4050E"
+
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		img.Set(x, x%8, color.NRGBA{R: 200, A: 255})
+	}
+	return img
+}
+
+func jpegSegment(marker byte, data string) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(data)+2))
+	return append(segment, data...)
+}
+
+func encodeJPEG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// phoneJPEG mimics a Multi-Picture file from a phone: EXIF with location, an
+// MPF index, fill bytes between segments and a secondary image after EOI
+// with its own EXIF.
+func phoneJPEG(t *testing.T) []byte {
+	primary := encodeJPEG(t)
+
+	var buf bytes.Buffer
+	buf.Write(primary[:2])
+	buf.Write(jpegSegment(0xE1, "Exif\x00\x00"+string(orientationEXIF(6))+secret))
+	buf.Write([]byte{0xFF, 0xFF, 0xFF})
+	buf.Write(jpegSegment(0xE2, "MPF\x00index"))
+	buf.Write(jpegSegment(0xFE, "comment by someone"))
+	buf.Write(primary[2:])
+
+	secondary := encodeJPEG(t)
+	buf.Write(secondary[:2])
+	buf.Write(jpegSegment(0xE1, "Exif\x00\x00"+secret+" secondary"))
+	buf.Write(secondary[2:])
+	return buf.Bytes()
+}
+
+func TestStripJPEG(t *testing.T) {
+	tests := []struct {
+		name        string
+		orientation int
+		exifBlocks  int
+	}{
+		{"upright", 1, 0},
+		{"rotated keeps orientation", 6, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Strip(bytes.NewReader(phoneJPEG(t)), &out, tt.orientation); err != nil {
+				t.Fatal(err)
+			}
+			data := out.Bytes()
+
+			for _, leaked := range []string{secret, "MPF\x00", "comment by someone"} {
+				if bytes.Contains(data, []byte(leaked)) {
+					t.Errorf("output still contains %q", leaked)
+				}
+			}
+			if n := bytes.Count(data, []byte("Exif\x00\x00")); n != tt.exifBlocks {
+				t.Errorf("found %d EXIF blocks, want %d", n, tt.exifBlocks)
+			}
+			if !bytes.HasSuffix(data, []byte{0xFF, 0xD9}) || bytes.Count(data, []byte{0xFF, 0xD8}) != 1 {
+				t.Error("output is not cut at the first image")
+			}
+			if got := Orientation(bytes.NewReader(data)); got != tt.orientation {
+				t.Errorf("orientation %d, want %d", got, tt.orientation)
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+				t.Errorf("output does not decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestStripJPEGProgressive(t *testing.T) {
+	// Tables between scans must survive, only APPn segments go
+	primary := encodeJPEG(t)
+	sos := bytes.Index(primary, []byte{0xFF, 0xDA})
+	eoi := len(primary) - 2
+
+	var in bytes.Buffer
+	in.Write(primary[:eoi])
+	in.Write(jpegSegment(0xE1, "Exif\x00\x00"+secret))
+	in.Write(jpegSegment(0xC4, "\x00table"))
+	in.Write(primary[eoi:])
+
+	var out bytes.Buffer
+	if err := Strip(bytes.NewReader(in.Bytes()), &out, 1); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out.Bytes(), []byte(secret)) {
+		t.Error("EXIF between scans was kept")
+	}
+	if !bytes.Contains(out.Bytes(), []byte("\x00table")) || !bytes.Equal(out.Bytes()[:sos], primary[:sos]) {
+		t.Error("segments needed to decode were changed")
+	}
+}
+
+func pngChunk(chunk, data string) []byte {
+	var buf bytes.Buffer
+	writePNGChunk(&buf, chunk, []byte(data))
+	return buf.Bytes()
+}
+
+func TestStripPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	original := encoded.Bytes()
+	idat := bytes.Index(original, []byte("IDAT")) - 4
+
+	var in bytes.Buffer
+	in.Write(original[:idat])
+	in.Write(pngChunk("eXIf", string(orientationEXIF(6))+secret))
+	in.Write(pngChunk("tEXt", "Author\x00"+secret))
+	in.Write(pngChunk("iTXt", "XML:com.adobe.xmp\x00\x00\x00\x00\x00"+secret))
+	in.Write(original[idat:])
+
+	var out bytes.Buffer
+	if err := Strip(bytes.NewReader(in.Bytes()), &out, 6); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+
+	if bytes.Contains(data, []byte(secret)) || bytes.Contains(data, []byte("tEXt")) || bytes.Contains(data, []byte("iTXt")) {
+		t.Error("text metadata was kept")
+	}
+	if n := bytes.Count(data, []byte("eXIf")); n != 1 {
+		t.Errorf("found %d eXIf chunks, want 1", n)
+	}
+	if got := Orientation(bytes.NewReader(data)); got != 6 {
+		t.Errorf("orientation %d, want 6", got)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("output does not decode: %v", err)
+	}
+}
+
+func webpChunk(chunk string, data []byte) []byte {
+	buf := append([]byte(chunk), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(data)))
+	buf = append(buf, data...)
+	if len(data)%2 == 1 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+func TestStripWebP(t *testing.T) {
+	vp8x := make([]byte, 10)
+	vp8x[0] = webpFlagEXIF | webpFlagXMP
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	body.Write(webpChunk("VP8X", vp8x))
+	body.Write(webpChunk("VP8L", []byte("pixels")))
+	body.Write(webpChunk("EXIF", append(orientationEXIF(6), secret...)))
+	body.Write(webpChunk("XMP ", []byte(secret)))
+
+	in := append([]byte("RIFF\x00\x00\x00\x00"), body.Bytes()...)
+	binary.LittleEndian.PutUint32(in[4:], uint32(body.Len()))
+
+	var out bytes.Buffer
+	if err := Strip(bytes.NewReader(in), &out, 6); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+
+	if bytes.Contains(data, []byte(secret)) || bytes.Contains(data, []byte("XMP ")) {
+		t.Error("metadata was kept")
+	}
+	if size := binary.LittleEndian.Uint32(data[4:8]); int(size) != len(data)-8 {
+		t.Errorf("RIFF size %d, file has %d bytes after the header", size, len(data)-8)
+	}
+	if flags := data[20]; flags&webpFlagXMP != 0 || flags&webpFlagEXIF == 0 {
+		t.Errorf("VP8X flags %08b, want EXIF set and XMP cleared", flags)
+	}
+	if got := Orientation(bytes.NewReader(data)); got != 6 {
+		t.Errorf("orientation %d, want 6", got)
+	}
+}
@@ -0,0 +1,43 @@
+package placeholder
+
+import (
+	"encoding/base64"
+	"github.com/buckket/go-blurhash"
+	"github.com/disintegration/imaging"
+	"image"
+)
+
+// BlurHash component counts, 4x3 is the size recommended by BlurHash for
+// most images.
+const BlurHashX = 4
+const BlurHashY = 3
+
+// Placeholders are tiny previews of an image that frontends decode inline
+// while the real file loads.
+type Placeholders struct {
+	BlurHash  string
+	ThumbHash string
+}
+
+// Generate computes the BlurHash and the base64 ThumbHash of img. Both work
+// on a downscaled copy, the result barely depends on the source size.
+func Generate(img image.Image) (Placeholders, error) {
+	var placeholders Placeholders
+
+	small := imaging.Fit(img, 32, 32, imaging.Box)
+	hash, err := blurhash.Encode(BlurHashX, BlurHashY, small)
+	if err != nil {
+		return placeholders, err
+	}
+	placeholders.BlurHash = hash
+
+	// ThumbHash is defined for at most 100x100 pixels
+	thumb := imaging.Fit(img, 100, 100, imaging.Box)
+	thumbHash, err := encodeThumbHash(thumb.Rect.Dx(), thumb.Rect.Dy(), thumb.Pix)
+	if err != nil {
+		return placeholders, err
+	}
+	placeholders.ThumbHash = base64.StdEncoding.EncodeToString(thumbHash)
+
+	return placeholders, nil
+}
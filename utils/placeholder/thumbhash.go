@@ -0,0 +1,143 @@
+package placeholder
+
+import (
+	"errors"
+	"math"
+)
+
+// encodeThumbHash is a port of rgbaToThumbHash from the ThumbHash reference
+// implementation (https://github.com/evanw/thumbhash). The image must be at
+// most 100x100 pixels, given as non-premultiplied RGBA bytes.
+func encodeThumbHash(w, h int, rgba []uint8) ([]byte, error) {
+	if w > 100 || h > 100 {
+		return nil, errors.New("thumbhash images must be at most 100x100")
+	}
+
+	var avgR, avgG, avgB, avgA float64
+	for i, j := 0, 0; i < w*h; i, j = i+1, j+4 {
+		alpha := float64(rgba[j+3]) / 255
+		avgR += alpha / 255 * float64(rgba[j])
+		avgG += alpha / 255 * float64(rgba[j+1])
+		avgB += alpha / 255 * float64(rgba[j+2])
+		avgA += alpha
+	}
+	if avgA > 0 {
+		avgR /= avgA
+		avgG /= avgA
+		avgB /= avgA
+	}
+
+	hasAlpha := avgA < float64(w*h)
+	lLimit := 7.0
+	if hasAlpha {
+		lLimit = 5
+	}
+	longest := float64(max(w, h))
+	lx := max(1, int(jsRound(lLimit*float64(w)/longest)))
+	ly := max(1, int(jsRound(lLimit*float64(h)/longest)))
+
+	l := make([]float64, w*h)
+	p := make([]float64, w*h)
+	q := make([]float64, w*h)
+	a := make([]float64, w*h)
+	for i, j := 0, 0; i < w*h; i, j = i+1, j+4 {
+		alpha := float64(rgba[j+3]) / 255
+		r := avgR*(1-alpha) + alpha/255*float64(rgba[j])
+		g := avgG*(1-alpha) + alpha/255*float64(rgba[j+1])
+		b := avgB*(1-alpha) + alpha/255*float64(rgba[j+2])
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+		a[i] = alpha
+	}
+
+	encodeChannel := func(channel []float64, nx, ny int) (float64, []float64, float64) {
+		var dc, scale float64
+		var ac []float64
+		fx := make([]float64, w)
+
+		for cy := 0; cy < ny; cy++ {
+			for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+				f := 0.0
+				for x := 0; x < w; x++ {
+					fx[x] = math.Cos(math.Pi / float64(w) * float64(cx) * (float64(x) + 0.5))
+				}
+				for y := 0; y < h; y++ {
+					fy := math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+					for x := 0; x < w; x++ {
+						f += channel[x+y*w] * fx[x] * fy
+					}
+				}
+				f /= float64(w * h)
+
+				if cx > 0 || cy > 0 {
+					ac = append(ac, f)
+					scale = math.Max(scale, math.Abs(f))
+				} else {
+					dc = f
+				}
+			}
+		}
+
+		if scale > 0 {
+			for i := range ac {
+				ac[i] = 0.5 + 0.5/scale*ac[i]
+			}
+		}
+		return dc, ac, scale
+	}
+
+	lDC, lAC, lScale := encodeChannel(l, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := encodeChannel(p, 3, 3)
+	qDC, qAC, qScale := encodeChannel(q, 3, 3)
+	var aDC, aScale float64
+	var aAC []float64
+	if hasAlpha {
+		aDC, aAC, aScale = encodeChannel(a, 5, 5)
+	}
+
+	isLandscape := w > h
+	header24 := uint32(jsRound(63*lDC)) |
+		uint32(jsRound(31.5+31.5*pDC))<<6 |
+		uint32(jsRound(31.5+31.5*qDC))<<12 |
+		uint32(jsRound(31*lScale))<<18
+	if hasAlpha {
+		header24 |= 1 << 23
+	}
+
+	header16 := uint32(lx)
+	if isLandscape {
+		header16 = uint32(ly)
+	}
+	header16 |= uint32(jsRound(63*pScale))<<3 | uint32(jsRound(63*qScale))<<9
+	if isLandscape {
+		header16 |= 1 << 15
+	}
+
+	hash := []byte{byte(header24), byte(header24 >> 8), byte(header24 >> 16), byte(header16), byte(header16 >> 8)}
+	acs := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		hash = append(hash, byte(jsRound(15*aDC))|byte(jsRound(15*aScale))<<4)
+		acs = append(acs, aAC)
+	}
+
+	acStart := len(hash)
+	acIndex := 0
+	for _, ac := range acs {
+		for _, f := range ac {
+			i := acStart + acIndex>>1
+			for len(hash) <= i {
+				hash = append(hash, 0)
+			}
+			hash[i] |= byte(jsRound(15*f)) << ((acIndex & 1) << 2)
+			acIndex++
+		}
+	}
+
+	return hash, nil
+}
+
+// jsRound rounds halves up like Math.round, which the reference relies on.
+func jsRound(x float64) float64 {
+	return math.Floor(x + 0.5)
+}
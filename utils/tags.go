@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+)
+
+// NormalizeTags trims and lowercases tags and drops empty and repeated ones.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized
+}